@@ -0,0 +1,21 @@
+package admin
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+func Authenticate(token string, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+		auth := req.Header.Get("Authorization")
+		if !strings.HasPrefix(auth, "Bearer ") ||
+			subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(auth, "Bearer ")), []byte(token)) != 1 {
+			writer.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+			writer.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		handler.ServeHTTP(writer, req)
+	})
+}
@@ -0,0 +1,46 @@
+package admin
+
+import (
+	"fmt"
+	"github.com/KnowitSolutions/istio-oidc/log"
+	"github.com/KnowitSolutions/istio-oidc/replication"
+	"github.com/KnowitSolutions/istio-oidc/state/session"
+	"net/http"
+)
+
+func RegisterRevocation(mux *http.ServeMux, sessStore session.Store, client replication.Client) {
+	rev := revocation{sessStore, client}
+	mux.Handle("/sessions/revoke", &rev)
+}
+
+type revocation struct {
+	sessions session.Store
+	client   replication.Client
+}
+
+func (r revocation) ServeHTTP(writer http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		writer.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	issuer, subject := req.FormValue("issuer"), req.FormValue("subject")
+	if issuer == "" || subject == "" {
+		writer.WriteHeader(http.StatusBadRequest)
+		_, _ = writer.Write([]byte("Missing issuer or subject"))
+		return
+	}
+
+	deleted := r.sessions.DeleteWhere(func(sess session.Session) bool {
+		return sess.Issuer == issuer && sess.Subject == subject
+	})
+	for _, sess := range deleted {
+		r.client.SetSession(sess)
+	}
+
+	vals := log.MakeValues("issuer", issuer, "subject", subject, "count", len(deleted))
+	log.Info(req.Context(), vals, "Revoked sessions")
+
+	writer.WriteHeader(http.StatusOK)
+	_, _ = writer.Write([]byte(fmt.Sprintf("Revoked %d sessions", len(deleted))))
+}
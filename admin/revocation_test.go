@@ -0,0 +1,124 @@
+package admin
+
+import (
+	"github.com/KnowitSolutions/istio-oidc/config"
+	"github.com/KnowitSolutions/istio-oidc/replication"
+	"github.com/KnowitSolutions/istio-oidc/state/session"
+	"github.com/KnowitSolutions/istio-oidc/state/usedstate"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	config.Replication.Mode = config.NoneMode
+	config.Sessions.TombstoneRetention = time.Hour
+	os.Exit(m.Run())
+}
+
+func TestRevocation(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		token  string
+		form   url.Values
+		status int
+		left   []string
+	}{
+		{
+			name:   "revoke",
+			method: http.MethodPost,
+			token:  "secret",
+			form:   url.Values{"issuer": {"https://idp"}, "subject": {"alice"}},
+			status: http.StatusOK,
+			left:   []string{"other-issuer", "bob"},
+		},
+		{
+			name:   "missing issuer",
+			method: http.MethodPost,
+			token:  "secret",
+			form:   url.Values{"subject": {"alice"}},
+			status: http.StatusBadRequest,
+			left:   []string{"alice-1", "alice-2", "other-issuer", "bob"},
+		},
+		{
+			name:   "missing subject",
+			method: http.MethodPost,
+			token:  "secret",
+			form:   url.Values{"issuer": {"https://idp"}},
+			status: http.StatusBadRequest,
+			left:   []string{"alice-1", "alice-2", "other-issuer", "bob"},
+		},
+		{
+			name:   "wrong method",
+			method: http.MethodGet,
+			token:  "secret",
+			status: http.StatusMethodNotAllowed,
+			left:   []string{"alice-1", "alice-2", "other-issuer", "bob"},
+		},
+		{
+			name:   "wrong token",
+			method: http.MethodPost,
+			token:  "wrong",
+			form:   url.Values{"issuer": {"https://idp"}, "subject": {"alice"}},
+			status: http.StatusUnauthorized,
+			left:   []string{"alice-1", "alice-2", "other-issuer", "bob"},
+		},
+		{
+			name:   "missing token",
+			method: http.MethodPost,
+			form:   url.Values{"issuer": {"https://idp"}, "subject": {"alice"}},
+			status: http.StatusUnauthorized,
+			left:   []string{"alice-1", "alice-2", "other-issuer", "bob"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sessStore, _ := session.NewSessionStore("test")
+			self := replication.NewSelf("test", sessStore, usedstate.NewUsedStateStore())
+			expiry := time.Now().Add(time.Hour)
+			for _, sess := range []session.Session{
+				{Id: "alice-1", Issuer: "https://idp", Subject: "alice", Expiry: expiry},
+				{Id: "alice-2", Issuer: "https://idp", Subject: "alice", Expiry: expiry},
+				{Id: "other-issuer", Issuer: "https://other", Subject: "alice", Expiry: expiry},
+				{Id: "bob", Issuer: "https://idp", Subject: "bob", Expiry: expiry},
+			} {
+				_, err := sessStore.Set(session.Stamped{Session: sess})
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			mux := http.NewServeMux()
+			RegisterRevocation(mux, sessStore, replication.Client{Self: self, Peers: replication.NewPeers()})
+			handler := Authenticate("secret", mux)
+
+			req := httptest.NewRequest(test.method, "/sessions/revoke", strings.NewReader(test.form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			if test.token != "" {
+				req.Header.Set("Authorization", "Bearer "+test.token)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != test.status {
+				t.Fatalf("status = %d, want %d", rec.Code, test.status)
+			}
+
+			left := map[string]bool{}
+			for _, id := range test.left {
+				left[id] = true
+			}
+			for _, id := range []string{"alice-1", "alice-2", "other-issuer", "bob"} {
+				if _, ok := sessStore.Get(id); ok != left[id] {
+					t.Errorf("session %q present = %v, want %v", id, ok, left[id])
+				}
+			}
+		})
+	}
+}
@@ -5,6 +5,7 @@ import (
 	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"net/url"
 	"regexp"
+	"strings"
 )
 
 // +kubebuilder:object:root=true
@@ -44,20 +45,57 @@ type AccessPolicySpec struct {
 
 	// +kubebuilder:validation:Optional
 	Routes []AccessPolicyRoute `json:"routes,omitempty"`
+	// +kubebuilder:validation:Optional
+	ErrorPages AccessPolicyErrorPages `json:"errorPages,omitempty"`
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Enum=V2;V3
+	TransportAPIVersion string `json:"transportAPIVersion,omitempty"`
+}
+
+type AccessPolicyErrorPages struct {
+	// +kubebuilder:validation:Optional
+	ConfigMapName string `json:"configMapName,omitempty"`
+	// +kubebuilder:validation:Optional
+	ExposeRoles bool `json:"exposeRoles,omitempty"`
 }
 
 func (in *AccessPolicySpec) Validate(errs []error) []error {
 	errs = in.OIDC.Validate(errs)
 
+	switch in.TransportAPIVersion {
+	case "", "V2", "V3":
+	default:
+		err := errors.New("invalid ext_authz transport API version", "version", in.TransportAPIVersion)
+		errs = append(errs, err)
+	}
+
 	names := make(map[string]struct{}, len(in.Routes))
 	for _, r := range in.Routes {
-		_, ok := names[r.Name]
-		if ok {
+		if r.Match != nil {
+			errs = r.Match.Validate(errs)
+		} else if _, ok := names[r.Name]; ok {
 			err := errors.New("duplicate route name", "name", r.Name)
 			errs = append(errs, err)
 		} else {
 			names[r.Name] = struct{}{}
 		}
+
+		if r.RoleExpression != nil {
+			errs = r.RoleExpression.Validate(errs)
+		}
+
+		errs = r.Unauthenticated.Validate(errs)
+
+		for _, h := range r.Headers {
+			if h.Value != "" && h.Template != "" {
+				err := errors.New("header cannot have both value and template", "route", r.Name, "header", h.Name)
+				errs = append(errs, err)
+			}
+
+			if h.RoleExpression != nil {
+				errs = h.RoleExpression.Validate(errs)
+			}
+		}
 	}
 
 	return errs
@@ -65,8 +103,28 @@ func (in *AccessPolicySpec) Validate(errs []error) []error {
 
 func (in *AccessPolicySpec) Normalize() {
 	in.OIDC.Normalize()
+
+	for i := range in.Routes {
+		in.Routes[i].Normalize()
+	}
+}
+
+var reservedAuthParams = map[string]bool{
+	"client_id":             true,
+	"redirect_uri":          true,
+	"response_type":         true,
+	"scope":                 true,
+	"state":                 true,
+	"nonce":                 true,
+	"code_challenge":        true,
+	"code_challenge_method": true,
 }
 
+func IsReservedAuthParam(name string) bool {
+	return reservedAuthParams[name] || strings.HasPrefix(name, "code_challenge")
+}
+
+// +kubebuilder:object:generate=true
 type AccessPolicyOIDC struct {
 	// +kubebuilder:validation:Pattern=`^([a-z-]+/)?[a-z-.]+$`
 	Provider          string                            `json:"provider"`
@@ -74,6 +132,29 @@ type AccessPolicyOIDC struct {
 	// +kubebuilder:validation:Optional
 	// +kubebuilder:validation:Pattern=`^\/[A-Za-z0-9\-._~!$&'()*+,;=:@\/%]*$|^$`
 	CallbackPath string `json:"callbackPath"`
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Pattern=`^\/[A-Za-z0-9\-._~!$&'()*+,;=:@\/%]*$|^$`
+	LoginPath string `json:"loginPath"`
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Pattern=`^\/[A-Za-z0-9\-._~!$&'()*+,;=:@\/%]*$|^$`
+	LogoutPath string `json:"logoutPath,omitempty"`
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Pattern=`^\/[A-Za-z0-9\-._~!$&'()*+,;=:@\/%]*$|^$`
+	FrontChannelLogoutPath string `json:"frontChannelLogoutPath,omitempty"`
+	// +kubebuilder:validation:Optional
+	PKCE *bool `json:"pkce,omitempty"`
+	// +kubebuilder:validation:Optional
+	Scopes []string `json:"scopes,omitempty"`
+	// +kubebuilder:validation:Optional
+	AuthParams map[string]string `json:"authParams,omitempty"`
+	// +kubebuilder:validation:Optional
+	Cookie AccessPolicyOIDCCookie `json:"cookie,omitempty"`
+	// +kubebuilder:validation:Optional
+	BearerTokens *AccessPolicyOIDCBearerTokens `json:"bearerTokens,omitempty"`
+	// +kubebuilder:validation:Optional
+	IdleTimeout meta.Duration `json:"idleTimeout,omitempty"`
+	// +kubebuilder:validation:Optional
+	MaxLifetime meta.Duration `json:"maxLifetime,omitempty"`
 }
 
 func (in *AccessPolicyOIDC) Validate(errs []error) []error {
@@ -90,15 +171,74 @@ func (in *AccessPolicyOIDC) Validate(errs []error) []error {
 		errs = append(errs, err)
 	}
 
+	_, err = url.Parse(in.LoginPath)
+	if err != nil {
+		err = errors.Wrap(err, "invalid login path")
+		errs = append(errs, err)
+	} else if in.LoginPath != "" && in.LoginPath == in.CallbackPath {
+		err = errors.New("login path equals callback path")
+		errs = append(errs, err)
+	}
+
+	_, err = url.Parse(in.LogoutPath)
+	if err != nil {
+		err = errors.Wrap(err, "invalid logout path")
+		errs = append(errs, err)
+	} else if in.LogoutPath != "" && in.LogoutPath == in.CallbackPath {
+		err = errors.New("logout path equals callback path")
+		errs = append(errs, err)
+	} else if in.LogoutPath != "" && in.LogoutPath == in.LoginPath {
+		err = errors.New("logout path equals login path")
+		errs = append(errs, err)
+	}
+
+	_, err = url.Parse(in.FrontChannelLogoutPath)
+	if err != nil {
+		err = errors.Wrap(err, "invalid front-channel logout path")
+		errs = append(errs, err)
+	} else if in.FrontChannelLogoutPath != "" && in.FrontChannelLogoutPath == in.CallbackPath {
+		err = errors.New("front-channel logout path equals callback path")
+		errs = append(errs, err)
+	} else if in.FrontChannelLogoutPath != "" && in.FrontChannelLogoutPath == in.LoginPath {
+		err = errors.New("front-channel logout path equals login path")
+		errs = append(errs, err)
+	} else if in.FrontChannelLogoutPath != "" && in.FrontChannelLogoutPath == in.LogoutPath {
+		err = errors.New("front-channel logout path equals logout path")
+		errs = append(errs, err)
+	}
+
+	errs = in.Cookie.Validate(errs)
+
+	if in.BearerTokens != nil && len(in.BearerTokens.Audiences) == 0 {
+		err := errors.New("bearer tokens require at least one audience")
+		errs = append(errs, err)
+	}
+
+	if in.IdleTimeout.Duration < 0 || in.MaxLifetime.Duration < 0 {
+		err := errors.New("session timeouts cannot be negative")
+		errs = append(errs, err)
+	}
+
+	for k := range in.AuthParams {
+		if IsReservedAuthParam(k) {
+			err := errors.New("reserved authorization parameter", "name", k)
+			errs = append(errs, err)
+		}
+	}
+
 	return errs
 }
 
 func (in *AccessPolicyOIDC) Normalize() {
 	in.CredentialsSecret.Normalize()
+	in.Cookie.Normalize()
 
 	if in.CallbackPath == "" {
 		in.CallbackPath = "/odic/callback"
 	}
+	if in.LoginPath == "" {
+		in.LoginPath = "/odic/login"
+	}
 }
 
 type AccessPolicyOIDCCredentialsSecret struct {
@@ -109,6 +249,41 @@ type AccessPolicyOIDCCredentialsSecret struct {
 	ClientSecretKey string `json:"clientSecretKey"`
 	// +kubebuilder:validation:Optional
 	TokenSecretKey string `json:"tokenSecretKey"`
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Enum=client_secret_basic;client_secret_post;client_secret_jwt;private_key_jwt;tls_client_auth;self_signed_tls_client_auth
+	ClientAuthMethod string `json:"clientAuthMethod,omitempty"`
+	// +kubebuilder:validation:Optional
+	PrivateKeyKey string `json:"privateKeyKey,omitempty"`
+	// +kubebuilder:validation:Optional
+	KeyIDKey string `json:"keyIDKey,omitempty"`
+	// +kubebuilder:validation:Optional
+	CertificateKey string `json:"certificateKey,omitempty"`
+}
+
+const (
+	ClientSecretBasic       = "client_secret_basic"
+	ClientSecretPost        = "client_secret_post"
+	ClientSecretJWT         = "client_secret_jwt"
+	PrivateKeyJWT           = "private_key_jwt"
+	TLSClientAuth           = "tls_client_auth"
+	SelfSignedTLSClientAuth = "self_signed_tls_client_auth"
+)
+
+func (in *AccessPolicyOIDCCredentialsSecret) UsesClientSecret() bool {
+	switch in.ClientAuthMethod {
+	case "", ClientSecretBasic, ClientSecretPost, ClientSecretJWT:
+		return true
+	default:
+		return false
+	}
+}
+
+func (in *AccessPolicyOIDCCredentialsSecret) UsesPrivateKey() bool {
+	return in.ClientAuthMethod == PrivateKeyJWT || in.UsesCertificate()
+}
+
+func (in *AccessPolicyOIDCCredentialsSecret) UsesCertificate() bool {
+	return in.ClientAuthMethod == TLSClientAuth || in.ClientAuthMethod == SelfSignedTLSClientAuth
 }
 
 func (in *AccessPolicyOIDCCredentialsSecret) Normalize() {
@@ -123,6 +298,62 @@ func (in *AccessPolicyOIDCCredentialsSecret) Normalize() {
 	if in.TokenSecretKey == "" {
 		in.TokenSecretKey = "tokenKey"
 	}
+
+	if in.PrivateKeyKey == "" {
+		in.PrivateKeyKey = "privateKey"
+	}
+
+	if in.KeyIDKey == "" {
+		in.KeyIDKey = "keyID"
+	}
+
+	if in.CertificateKey == "" {
+		in.CertificateKey = "certificate"
+	}
+}
+
+// +kubebuilder:object:generate=true
+type AccessPolicyOIDCBearerTokens struct {
+	// +kubebuilder:validation:MinItems=1
+	Audiences []string `json:"audiences"`
+}
+
+type AccessPolicyOIDCCookie struct {
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Pattern=`^[A-Za-z0-9!#$%&'*+\-.^_|~]*$`
+	Name string `json:"name,omitempty"`
+	// +kubebuilder:validation:Optional
+	Domain string `json:"domain,omitempty"`
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Pattern=`^\/[A-Za-z0-9\-._~!$&'()*+,;=:@\/%]*$|^$`
+	Path string `json:"path,omitempty"`
+	// +kubebuilder:validation:Optional
+	Secure bool `json:"secure,omitempty"`
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Enum=Strict;Lax;None
+	SameSite string `json:"sameSite,omitempty"`
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Minimum=0
+	MaxAge int `json:"maxAge,omitempty"`
+}
+
+func (in *AccessPolicyOIDCCookie) Validate(errs []error) []error {
+	if in.SameSite == "None" && !in.Secure {
+		err := errors.New("cookies with SameSite=None must be secure")
+		errs = append(errs, err)
+	}
+
+	return errs
+}
+
+func (in *AccessPolicyOIDCCookie) Normalize() {
+	if in.Name == "" {
+		in.Name = "bearer"
+	}
+
+	if in.Path == "" {
+		in.Path = "/"
+	}
 }
 
 // +kubebuilder:object:generate=true
@@ -130,11 +361,126 @@ type AccessPolicyRoute struct {
 	// +kubebuilder:validation:Optional
 	Name string `json:"name,omitempty"`
 	// +kubebuilder:validation:Optional
+	Match *AccessPolicyRouteMatch `json:"match,omitempty"`
+	// +kubebuilder:validation:Optional
 	Roles []string `json:"roles,omitempty"`
 	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Type=object
+	// +kubebuilder:pruning:PreserveUnknownFields
+	RoleExpression *AccessPolicyRoleExpression `json:"roleExpression,omitempty"`
+	// +kubebuilder:validation:Optional
 	Headers []AccessPolicyRouteHeader `json:"headers,omitempty"`
 	// +kubebuilder:validation:Optional
 	DisableEnforcement bool `json:"disableEnforcement,omitempty"`
+	// +kubebuilder:validation:Optional
+	ForwardAccessToken *AccessPolicyRouteForwardAccessToken `json:"forwardAccessToken,omitempty"`
+	// +kubebuilder:validation:Optional
+	Unauthenticated AccessPolicyRouteUnauthenticated `json:"unauthenticated,omitempty"`
+}
+
+func (in *AccessPolicyRoute) Normalize() {
+	in.Unauthenticated.Normalize()
+
+	if in.ForwardAccessToken != nil {
+		in.ForwardAccessToken.Normalize()
+	}
+}
+
+// +kubebuilder:object:generate=true
+type AccessPolicyRouteUnauthenticated struct {
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Enum=401;403
+	Status int `json:"status,omitempty"`
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Enum=json;empty
+	Format string `json:"format,omitempty"`
+	// +kubebuilder:validation:Optional
+	APIHeaders []AccessPolicyRouteHeaderRule `json:"apiHeaders,omitempty"`
+}
+
+func (in *AccessPolicyRouteUnauthenticated) Validate(errs []error) []error {
+	for _, h := range in.APIHeaders {
+		_, err := regexp.Compile(h.Regex)
+		if err != nil {
+			err = errors.Wrap(err, "invalid API header regex", "header", h.Name)
+			errs = append(errs, err)
+		}
+	}
+
+	return errs
+}
+
+func (in *AccessPolicyRouteUnauthenticated) Normalize() {
+	if in.Status == 0 {
+		in.Status = 401
+	}
+
+	if in.Format == "" {
+		in.Format = "json"
+	}
+}
+
+type AccessPolicyRouteHeaderRule struct {
+	Name string `json:"name"`
+	// +kubebuilder:validation:Optional
+	Regex string `json:"regex,omitempty"`
+}
+
+// +kubebuilder:object:generate=true
+type AccessPolicyRouteMatch struct {
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Pattern=`^\/`
+	Prefix string `json:"prefix,omitempty"`
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Pattern=`^\/`
+	Path string `json:"path,omitempty"`
+	// +kubebuilder:validation:Optional
+	Regex string `json:"regex,omitempty"`
+	// +kubebuilder:validation:Optional
+	Methods []AccessPolicyRouteMatchMethod `json:"methods,omitempty"`
+}
+
+// +kubebuilder:validation:Enum=GET;HEAD;POST;PUT;PATCH;DELETE;CONNECT;OPTIONS;TRACE
+type AccessPolicyRouteMatchMethod string
+
+func (in *AccessPolicyRouteMatch) Validate(errs []error) []error {
+	set := 0
+	for _, v := range []string{in.Prefix, in.Path, in.Regex} {
+		if v != "" {
+			set++
+		}
+	}
+
+	if set > 1 {
+		err := errors.New("route match can have at most one of prefix, path or regex")
+		errs = append(errs, err)
+	} else if set == 0 && len(in.Methods) == 0 {
+		err := errors.New("route match must have a path or method")
+		errs = append(errs, err)
+	}
+
+	if in.Regex != "" {
+		_, err := regexp.Compile(in.Regex)
+		if err != nil {
+			err = errors.Wrap(err, "invalid route regex", "regex", in.Regex)
+			errs = append(errs, err)
+		}
+	}
+
+	return errs
+}
+
+// +kubebuilder:object:generate=true
+type AccessPolicyRouteForwardAccessToken struct {
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Pattern=`^[A-Za-z0-9\-_]+$`
+	Header string `json:"header,omitempty"`
+}
+
+func (in *AccessPolicyRouteForwardAccessToken) Normalize() {
+	if in.Header == "" {
+		in.Header = "authorization"
+	}
 }
 
 // +kubebuilder:object:generate=true
@@ -142,7 +488,66 @@ type AccessPolicyRouteHeader struct {
 	Name  string   `json:"name"`
 	Roles []string `json:"roles"`
 	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Type=object
+	// +kubebuilder:pruning:PreserveUnknownFields
+	RoleExpression *AccessPolicyRoleExpression `json:"roleExpression,omitempty"`
+	// +kubebuilder:validation:Optional
 	Value string `json:"value,omitempty"`
+	// +kubebuilder:validation:Optional
+	Template string `json:"template,omitempty"`
+}
+
+// +kubebuilder:object:generate=true
+type AccessPolicyRoleExpression struct {
+	// +kubebuilder:validation:Optional
+	Role string `json:"role,omitempty"`
+	// +kubebuilder:validation:Optional
+	AllOf []AccessPolicyRoleExpression `json:"allOf,omitempty"`
+	// +kubebuilder:validation:Optional
+	AnyOf []AccessPolicyRoleExpression `json:"anyOf,omitempty"`
+	// +kubebuilder:validation:Optional
+	Not *AccessPolicyRoleExpression `json:"not,omitempty"`
+}
+
+func (in *AccessPolicyRoleExpression) Validate(errs []error) []error {
+	set := 0
+	if in.Role != "" {
+		set++
+	}
+	if in.AllOf != nil {
+		set++
+	}
+	if in.AnyOf != nil {
+		set++
+	}
+	if in.Not != nil {
+		set++
+	}
+
+	if set != 1 {
+		err := errors.New("role expression must have exactly one of role, allOf, anyOf or not")
+		errs = append(errs, err)
+	}
+	if in.AllOf != nil && len(in.AllOf) == 0 {
+		err := errors.New("role expression allOf cannot be empty")
+		errs = append(errs, err)
+	}
+	if in.AnyOf != nil && len(in.AnyOf) == 0 {
+		err := errors.New("role expression anyOf cannot be empty")
+		errs = append(errs, err)
+	}
+
+	for i := range in.AllOf {
+		errs = in.AllOf[i].Validate(errs)
+	}
+	for i := range in.AnyOf {
+		errs = in.AnyOf[i].Validate(errs)
+	}
+	if in.Not != nil {
+		errs = in.Not.Validate(errs)
+	}
+
+	return errs
 }
 
 // +kubebuilder:object:generate=true
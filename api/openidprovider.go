@@ -27,6 +27,18 @@ type OpenIDProviderSpec struct {
 	Issuer string `json:"issuer"`
 	// +kubebuilder:validation:Optional
 	RoleMappings []OpenIDProviderRoleMapping `json:"roleMappings"`
+	// +kubebuilder:validation:Optional
+	ClaimMappings []OpenIDProviderClaimMapping `json:"claimMappings,omitempty"`
+	// +kubebuilder:validation:Optional
+	PKCE bool `json:"pkce,omitempty"`
+	// +kubebuilder:validation:Optional
+	Scopes []string `json:"scopes,omitempty"`
+	// +kubebuilder:validation:Optional
+	AuthParams map[string]string `json:"authParams,omitempty"`
+	// +kubebuilder:validation:Optional
+	IntrospectionEndpoint string `json:"introspectionEndpoint,omitempty"`
+	// +kubebuilder:validation:Optional
+	RefreshTokenLifetime meta.Duration `json:"refreshTokenLifetime,omitempty"`
 }
 
 type OpenIDProviderRoleMapping struct {
@@ -36,3 +48,10 @@ type OpenIDProviderRoleMapping struct {
 	Prefix string `json:"prefix"`
 	Path   string `json:"path"`
 }
+
+type OpenIDProviderClaimMapping struct {
+	Name string `json:"name"`
+	// +kubebuilder:validation:Optional
+	From string `json:"from"`
+	Path string `json:"path"`
+}
@@ -0,0 +1,49 @@
+package auth
+
+import (
+	"context"
+	"github.com/KnowitSolutions/istio-oidc/config"
+	"github.com/KnowitSolutions/istio-oidc/log"
+	"github.com/KnowitSolutions/istio-oidc/log/errors"
+	"github.com/KnowitSolutions/istio-oidc/state/session"
+	"golang.org/x/oauth2"
+	"time"
+)
+
+func (srv *Server) accessToken(ctx context.Context, req *request) (string, error) {
+	if req.accessToken != "" {
+		return req.accessToken, nil
+	}
+
+	sess := req.session
+	margin := time.Now().Add(config.Sessions.AccessTokenMargin)
+	if sess.AccessToken != "" && (sess.AccessTokenExpiry.IsZero() || margin.Before(sess.AccessTokenExpiry)) {
+		return sess.AccessToken, nil
+	}
+
+	log.Info(ctx, nil, "Refreshing access token")
+
+	cfg := req.policy.Oidc.OAuth2(req.url)
+	tokCtx := req.policy.Oidc.TokenContext(ctx)
+	src := cfg.TokenSource(tokCtx, &oauth2.Token{RefreshToken: sess.RefreshToken})
+
+	tok, err := src.Token()
+	if err != nil {
+		return "", errors.Wrap(err, "failed refreshing access token")
+	}
+
+	sess.AccessToken = tok.AccessToken
+	sess.AccessTokenExpiry = tok.Expiry
+	if tok.RefreshToken != "" {
+		sess.RefreshToken = tok.RefreshToken
+	}
+
+	stamped, err := srv.Sessions.Set(session.Stamped{Session: sess})
+	if err != nil {
+		return "", errors.Wrap(err, "failed storing access token")
+	}
+	srv.Client.SetSession(stamped)
+
+	req.session = sess
+	return sess.AccessToken, nil
+}
@@ -0,0 +1,109 @@
+package auth
+
+import (
+	"github.com/KnowitSolutions/istio-oidc/api"
+	"net/http"
+	"testing"
+)
+
+func TestAccessToken(t *testing.T) {
+	tests := []struct {
+		name      string
+		expiresIn int
+		want      string
+		refreshed bool
+	}{
+		{"valid", 300, "Bearer opaque-access-token", false},
+		{"within margin", 10, "Bearer refreshed-access-token", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			idp := newFakeIdp(t)
+			idp.expiresIn = test.expiresIn
+			srv := newTestServer(t, idp, func(ap *api.AccessPolicy) {
+				ap.Spec.Routes = []api.AccessPolicyRoute{{
+					Match:              &api.AccessPolicyRouteMatch{Prefix: "/"},
+					ForwardAccessToken: &api.AccessPolicyRouteForwardAccessToken{Header: "x-access-token"},
+				}}
+			})
+
+			l := startLogin(t, srv, idp, "https://app.example.com/odic/login")
+			res := l.callback(t, srv, l.cookie)
+			if res.status != http.StatusSeeOther {
+				t.Fatalf("callback status = %d, want %d", res.status, http.StatusSeeOther)
+			}
+			cookie := res.cookies[0]
+
+			idp.mu.Lock()
+			idp.accessToken = "refreshed-access-token"
+			idp.refreshToken = "rotated-refresh-token"
+			idp.mu.Unlock()
+
+			headers := map[string]string{"cookie": cookieHeader(cookie)}
+			res = srv.testCheck(t, http.MethodGet, "https://app.example.com/page", headers)
+			if res.status != http.StatusOK {
+				t.Fatalf("status = %d, want %d", res.status, http.StatusOK)
+			}
+			if got := res.headers["x-access-token"]; got != test.want {
+				t.Errorf("access token header = %q, want %q", got, test.want)
+			}
+
+			idp.mu.Lock()
+			grant := idp.form.Get("grant_type")
+			idp.mu.Unlock()
+			if refreshed := grant == "refresh_token"; refreshed != test.refreshed {
+				t.Errorf("refreshed = %v, want %v", refreshed, test.refreshed)
+			}
+
+			sess := sessionOf(t, srv, cookie)
+			wantRefresh := "opaque-refresh-token"
+			if test.refreshed {
+				wantRefresh = "rotated-refresh-token"
+			}
+			if sess.RefreshToken != wantRefresh {
+				t.Errorf("session refresh token = %q, want %q", sess.RefreshToken, wantRefresh)
+			}
+		})
+	}
+}
+
+func TestAccessTokenRotatedRefreshToken(t *testing.T) {
+	idp := newFakeIdp(t)
+	idp.expiresIn = 10
+	srv := newTestServer(t, idp, func(ap *api.AccessPolicy) {
+		ap.Spec.Routes = []api.AccessPolicyRoute{{
+			Match:              &api.AccessPolicyRouteMatch{Prefix: "/"},
+			ForwardAccessToken: &api.AccessPolicyRouteForwardAccessToken{},
+		}}
+	})
+
+	l := startLogin(t, srv, idp, "https://app.example.com/odic/login")
+	cookie := l.callback(t, srv, l.cookie).cookies[0]
+	headers := map[string]string{"cookie": cookieHeader(cookie)}
+
+	for _, rotated := range []string{"first-refresh-token", "second-refresh-token"} {
+		idp.mu.Lock()
+		prev := idp.refreshToken
+		idp.refreshToken = rotated
+		idp.mu.Unlock()
+		if prev == "" {
+			prev = "opaque-refresh-token"
+		}
+
+		res := srv.testCheck(t, http.MethodGet, "https://app.example.com/page", headers)
+		if res.status != http.StatusOK {
+			t.Fatalf("status = %d, want %d", res.status, http.StatusOK)
+		}
+		if got := res.headers["authorization"]; got != "Bearer opaque-access-token" {
+			t.Errorf("authorization = %q, want forwarded access token", got)
+		}
+
+		idp.mu.Lock()
+		used := idp.form.Get("refresh_token")
+		idp.mu.Unlock()
+		if used != prev {
+			t.Errorf("refreshed with %q, want %q", used, prev)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package auth
+
+import (
+	"context"
+	"github.com/KnowitSolutions/istio-oidc/log"
+	"github.com/KnowitSolutions/istio-oidc/state/session"
+	"net/http"
+	"strings"
+)
+
+func (srv *ServerHTTP) backChannelLogout(ctx context.Context, writer http.ResponseWriter, req *http.Request, params string) {
+	writer.Header().Set("Cache-Control", "no-store")
+
+	if req.Method != http.MethodPost {
+		writer.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	ap := srv.AccessPolicies.Get(strings.Trim(params, "/"))
+	if ap == nil {
+		vals := log.MakeValues("AccessPolicy", params)
+		log.Info(ctx, vals, "Back-channel logout for unknown AccessPolicy")
+		writer.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	tok := req.PostFormValue("logout_token")
+	if tok == "" {
+		writer.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	data, err := ap.Oidc.Provider.LogoutData(ctx, tok, ap.Oidc.ClientId)
+	if err != nil {
+		log.Error(ctx, err, "Invalid logout token")
+		writer.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	deleted := srv.Sessions.DeleteWhere(func(sess session.Session) bool {
+		if sess.Issuer != data.Issuer {
+			return false
+		} else if data.SessionId != "" {
+			return sess.SessionId == data.SessionId
+		} else {
+			return sess.Subject == data.Subject
+		}
+	})
+	for _, sess := range deleted {
+		srv.Client.SetSession(sess)
+	}
+
+	vals := log.MakeValues("AccessPolicy", ap.Name, "subject", data.Subject, "sid", data.SessionId, "count", len(deleted))
+	log.Info(ctx, vals, "Back-channel logout")
+
+	writer.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,54 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"github.com/KnowitSolutions/istio-oidc/log"
+	"gopkg.in/square/go-jose.v2/jwt"
+	"net/http"
+	"strings"
+)
+
+func (req *request) authorization() string {
+	value := req.headers["authorization"]
+	if len(value) > 7 && strings.EqualFold(value[:7], "Bearer ") {
+		return strings.TrimSpace(value[7:])
+	} else {
+		return ""
+	}
+}
+
+// A request carrying both an invalid bearer token and a session cookie is
+// handled as a cookie request, since browsers may attach stale credentials.
+func (srv *Server) checkBearer(ctx context.Context, req *request) *response {
+	token := req.authorization()
+	if token == "" || !req.policy.Oidc.AcceptsBearerTokens() {
+		return nil
+	}
+
+	tokCtx := req.policy.Oidc.TokenContext(ctx)
+	creds := req.policy.Oidc.Credentials()
+	data, err := req.policy.Oidc.Provider.BearerData(tokCtx, token, req.policy.Oidc.BearerAudiences, creds)
+	if err != nil && req.bearer() != "" {
+		log.Error(ctx, err, "Invalid bearer token, falling back to session cookie")
+		return nil
+	} else if err != nil {
+		log.Error(ctx, err, "Invalid bearer token")
+		res := &response{status: http.StatusUnauthorized, headers: map[string]string{}}
+		res.headers["www-authenticate"] = fmt.Sprintf("Bearer realm=%q, error=\"invalid_token\"", req.policy.Name)
+		if req.route.Unauthenticated.Format == "json" {
+			res.headers["content-type"] = "application/json"
+			res.body = `{"error":"invalid_token"}`
+		}
+		return res
+	}
+
+	req.claims = bearerClaims{
+		claims: claims{jwt.Claims{Subject: data.Subject, Expiry: jwt.NewNumericDate(data.Expiry)}},
+		Roles:  data.Roles,
+		Claims: data.Claims,
+	}
+	req.accessToken = token
+
+	return srv.authorize(ctx, req)
+}
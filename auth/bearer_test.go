@@ -0,0 +1,85 @@
+package auth
+
+import (
+	"github.com/KnowitSolutions/istio-oidc/api"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBearer(t *testing.T) {
+	tests := []struct {
+		name    string
+		token   func(*fakeIdp) string
+		session bool
+		want    int
+	}{
+		{
+			name:  "valid",
+			token: func(idp *fakeIdp) string { return idp.sign(t, bearerClaimsFor(idp, "api")) },
+			want:  http.StatusOK,
+		},
+		{
+			name:  "wrong audience",
+			token: func(idp *fakeIdp) string { return idp.sign(t, bearerClaimsFor(idp, "client")) },
+			want:  http.StatusUnauthorized,
+		},
+		{
+			name: "ID token",
+			token: func(idp *fakeIdp) string {
+				claims := bearerClaimsFor(idp, "api")
+				claims["nonce"] = "nonce"
+				return idp.sign(t, claims)
+			},
+			want: http.StatusUnauthorized,
+		},
+		{
+			name:  "invalid",
+			token: func(*fakeIdp) string { return "garbage" },
+			want:  http.StatusUnauthorized,
+		},
+		{
+			name:    "invalid with session",
+			token:   func(*fakeIdp) string { return "garbage" },
+			session: true,
+			want:    http.StatusOK,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			idp := newFakeIdp(t)
+			srv := newTestServer(t, idp, func(ap *api.AccessPolicy) {
+				ap.Spec.OIDC.BearerTokens = &api.AccessPolicyOIDCBearerTokens{Audiences: []string{"api"}}
+			})
+
+			headers := map[string]string{"authorization": "Bearer " + test.token(idp)}
+			if test.session {
+				l := startLogin(t, srv, idp, "https://app.example.com/")
+				res := l.callback(t, srv, l.cookie)
+				if res.status != http.StatusSeeOther || len(res.cookies) == 0 {
+					t.Fatalf("login failed with status %d", res.status)
+				}
+				headers["cookie"] = cookieHeader(res.cookies[0])
+			}
+
+			res := srv.testCheck(t, http.MethodGet, "https://app.example.com/", headers)
+			if res.status != test.want {
+				t.Fatalf("status = %d, want %d", res.status, test.want)
+			}
+			if test.want == http.StatusUnauthorized && !strings.Contains(res.headers["www-authenticate"], `error="invalid_token"`) {
+				t.Errorf("www-authenticate = %q, want invalid_token", res.headers["www-authenticate"])
+			}
+		})
+	}
+}
+
+func bearerClaimsFor(idp *fakeIdp, aud string) map[string]interface{} {
+	return map[string]interface{}{
+		"iss": idp.URL,
+		"sub": "user",
+		"aud": aud,
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}
+}
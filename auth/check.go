@@ -3,23 +3,32 @@ package auth
 import (
 	"context"
 	"crypto/sha512"
+	"crypto/subtle"
+	"github.com/KnowitSolutions/istio-oidc/config"
 	"github.com/KnowitSolutions/istio-oidc/log"
 	"github.com/KnowitSolutions/istio-oidc/log/errors"
+	"github.com/KnowitSolutions/istio-oidc/state/accesspolicy"
+	"github.com/KnowitSolutions/istio-oidc/state/openidprovider"
 	"github.com/KnowitSolutions/istio-oidc/state/session"
 	"golang.org/x/oauth2"
 	"net/http"
+	"net/url"
 	"strings"
 	"time"
 )
 
 type stateClaims struct {
 	claims
-	Path string `json:"path"`
+	URL      string `json:"url"`
+	Verifier string `json:"cv,omitempty"`
+	Nonce    string `json:"nonce"`
+	Binding  string `json:"bnd"`
 }
 
 type bearerClaims struct {
 	claims
-	Roles map[string][]string `json:"rol"`
+	Roles  map[string][]string `json:"rol"`
+	Claims map[string][]string `json:"clm,omitempty"`
 }
 
 func (srv *Server) check(ctx context.Context, req *request) *response {
@@ -30,29 +39,57 @@ func (srv *Server) check(ctx context.Context, req *request) *response {
 	if req.policy.Oidc.IsCallback(req.url) {
 		reqCallbackCount.WithLabelValues(req.policy.Name).Inc()
 		res = srv.finishOidc(ctx, req)
+	} else if req.policy.Oidc.IsLogin(req.url) {
+		reqLoginCount.WithLabelValues(req.policy.Name).Inc()
+		res = srv.login(ctx, req)
+	} else if req.policy.Oidc.IsLogout(req.url) {
+		reqLogoutCount.WithLabelValues(req.policy.Name).Inc()
+		res = srv.logout(ctx, req)
+	} else if req.policy.Oidc.IsFrontChannelLogout(req.url) {
+		reqFrontChannelCount.WithLabelValues(req.policy.Name).Inc()
+		res = srv.frontChannelLogout(ctx, req)
+	} else if !req.route.EnableAuthz {
+		res = &response{status: http.StatusOK}
+	} else if res = srv.checkBearer(ctx, req); res != nil {
+		reqBearerCount.WithLabelValues(req.policy.Name).Inc()
 	} else if !srv.isAuthenticated(ctx, req) {
 		reqUnauthdCount.WithLabelValues(req.policy.Name).Inc()
 		res = srv.startOidc(ctx, req)
+	} else if srv.isTimedOut(ctx, req) {
+		reqTimedOutCount.WithLabelValues(req.policy.Name).Inc()
+		res = srv.restartOidc(ctx, req)
 	} else if req.claims.isExpired() {
-		reqExpiredCount.WithLabelValues(req.policy.Name).Inc()
 		res = srv.updateToken(ctx, req)
+		if res.refreshFailed {
+			reqRefreshFailedCount.WithLabelValues(req.policy.Name).Inc()
+		} else {
+			reqExpiredCount.WithLabelValues(req.policy.Name).Inc()
+		}
 	} else {
 		reqAuthdCount.WithLabelValues(req.policy.Name).Inc()
 		res = srv.authorize(ctx, req)
 	}
 
-	switch res.status {
-	case http.StatusOK:
+	srv.errorPage(ctx, req, res)
+
+	switch {
+	case res.refreshFailed:
+		resRefreshFailedCount.WithLabelValues(req.policy.Name).Inc()
+	case res.local:
+		resOtherCount.WithLabelValues(req.policy.Name).Inc()
+	case res.status == http.StatusOK:
 		resAllowedCount.WithLabelValues(req.policy.Name).Inc()
-	case http.StatusSeeOther:
+	case res.status == http.StatusSeeOther:
 		fallthrough
-	case http.StatusTemporaryRedirect:
+	case res.status == http.StatusTemporaryRedirect:
 		resRedirCount.WithLabelValues(req.policy.Name).Inc()
-	case http.StatusBadRequest:
+	case res.status == http.StatusUnauthorized:
+		resUnauthdCount.WithLabelValues(req.policy.Name).Inc()
+	case res.status == http.StatusBadRequest:
 		resBadReqCount.WithLabelValues(req.policy.Name).Inc()
-	case http.StatusForbidden:
+	case res.status == http.StatusForbidden:
 		resDeniedCount.WithLabelValues(req.policy.Name).Inc()
-	case http.StatusInternalServerError:
+	case res.status == http.StatusInternalServerError:
 		resErrorCount.WithLabelValues(req.policy.Name).Inc()
 	default:
 		resOtherCount.WithLabelValues(req.policy.Name).Inc()
@@ -82,35 +119,89 @@ func (srv *Server) isAuthenticated(ctx context.Context, req *request) bool {
 }
 
 func (srv *Server) startOidc(ctx context.Context, req *request) *response {
-	switch req.fetchMode {
-	case "":
-	case "navigate":
-	case "nested-navigate":
-	default:
-		log.Info(ctx, nil, "Skipping OIDC for non-navigation request")
-		return &response{status: http.StatusForbidden}
+	if !req.isNavigation() {
+		return srv.unauthenticated(ctx, req)
 	}
 
+	return srv.redirectOidc(ctx, req, req.url.String())
+}
+
+func (srv *Server) redirectOidc(ctx context.Context, req *request, target string) *response {
 	log.Info(ctx, nil, "Starting OIDC")
 
-	claims := &stateClaims{Path: req.url.Path}
-	tok, err := makeToken(req.policy.Oidc.TokenSecret, claims, time.Time{})
+	nonce, err := makeRandom()
+	if err != nil {
+		err = errors.Wrap(err, "failed generating nonce")
+		log.Error(ctx, err, "Unable to start OIDC flow")
+		return &response{status: http.StatusInternalServerError}
+	}
+
+	id, err := makeRandom()
+	if err != nil {
+		err = errors.Wrap(err, "failed generating state ID")
+		log.Error(ctx, err, "Unable to start OIDC flow")
+		return &response{status: http.StatusInternalServerError}
+	}
+
+	binding, err := makeRandom()
+	if err != nil {
+		err = errors.Wrap(err, "failed generating state binding")
+		log.Error(ctx, err, "Unable to start OIDC flow")
+		return &response{status: http.StatusInternalServerError}
+	}
+
+	claims := &stateClaims{URL: target, Nonce: nonce, Binding: binding}
+	claims.ID = id
+	opts := req.policy.Oidc.AuthCodeOptions()
+	opts = append(opts, oauth2.SetAuthURLParam("nonce", nonce))
+	if req.policy.Oidc.UsePKCE() {
+		verifier, err := makeVerifier()
+		if err != nil {
+			log.Error(ctx, err, "Unable to start OIDC flow")
+			return &response{status: http.StatusInternalServerError}
+		}
+
+		claims.Verifier = verifier
+		opts = append(opts,
+			oauth2.SetAuthURLParam("code_challenge", makeChallenge(verifier)),
+			oauth2.SetAuthURLParam("code_challenge_method", "S256"))
+	}
+
+	expiry := time.Now().Add(config.Sessions.StateLifetime)
+	tok, err := makeEncryptedToken(req.policy.Oidc.TokenSecret, claims, expiry)
 	if err != nil {
 		log.Error(ctx, err, "Unable to start OIDC flow")
 		return &response{status: http.StatusInternalServerError}
 	}
 
 	cfg := req.policy.Oidc.OAuth2(req.url)
-	loc := cfg.AuthCodeURL(tok)
+	loc := cfg.AuthCodeURL(tok, opts...)
+
+	cookie := &http.Cookie{
+		Name:     stateCookie + "-" + id,
+		Value:    binding,
+		Path:     req.policy.Oidc.Callback.Path,
+		MaxAge:   int(config.Sessions.StateLifetime.Seconds()),
+		Secure:   req.policy.Oidc.Cookie.IsSecure(req.url),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}
 
 	headers := map[string]string{"location": loc}
-	return &response{status: http.StatusSeeOther, headers: headers}
+	return &response{status: http.StatusSeeOther, headers: headers, cookies: []*http.Cookie{cookie}}
 }
 
 func (srv *Server) finishOidc(ctx context.Context, req *request) *response {
 	log.Info(ctx, nil, "Finishing OIDC")
 
 	query := req.url.Query()
+	if query.Get("error") != "" {
+		vals := log.MakeValues("error", query.Get("error"), "description", query.Get("error_description"))
+		log.Info(ctx, vals, "OpenID provider returned an error")
+		data := &errorPageData{Error: query.Get("error")}
+		return &response{status: http.StatusForbidden, page: accesspolicy.IdpErrorPage, pageData: data}
+	}
+
 	if query["state"] == nil || len(query["state"]) != 1 ||
 		query["code"] == nil || len(query["code"]) != 1 {
 		log.Error(ctx, nil, "Invalid OIDC callback")
@@ -118,46 +209,115 @@ func (srv *Server) finishOidc(ctx context.Context, req *request) *response {
 	}
 
 	claims := &stateClaims{}
-	err := parseToken(req.policy.Oidc.TokenSecret, query["state"][0], claims)
+	err := parseEncryptedToken(req.policy.Oidc.TokenSecret, query["state"][0], claims)
 	if err != nil {
-		log.Error(ctx, nil, "Unable to finnish OIDC flow")
+		log.Error(ctx, err, "Unable to finnish OIDC flow")
+		return &response{status: http.StatusBadRequest}
+	}
+
+	if claims.isExpired() {
+		log.Error(ctx, nil, "Expired OIDC state")
+		return &response{status: http.StatusBadRequest}
+	}
+
+	cookie := stateCookie + "-" + claims.ID
+	binding := req.cookie(cookie)
+	if subtle.ConstantTimeCompare([]byte(binding), []byte(claims.Binding)) != 1 {
+		log.Error(ctx, nil, "OIDC state is not bound to this browser")
 		return &response{status: http.StatusBadRequest}
 	}
 
+	if !srv.UsedStates.Use(claims.ID, claims.Expiry.Time()) {
+		log.Error(ctx, nil, "OIDC state has already been used")
+		return &response{status: http.StatusBadRequest}
+	}
+	srv.Client.UseState(claims.ID, claims.Expiry.Time())
+
+	opts := req.policy.Oidc.TokenOptions()
+	if claims.Verifier != "" {
+		opts = append(opts, oauth2.SetAuthURLParam("code_verifier", claims.Verifier))
+	}
+
 	cfg := req.policy.Oidc.OAuth2(req.url)
-	tok, err := cfg.Exchange(ctx, query["code"][0])
+	tokCtx := req.policy.Oidc.TokenContext(ctx)
+	tok, err := cfg.Exchange(tokCtx, query["code"][0], opts...)
 	if err != nil {
 		err = errors.Wrap(
 			err, "failed authorization code exchange",
 			"clientId", cfg.ClientID,
 			"url", cfg.Endpoint.TokenURL,
-			"roles", strings.Join(cfg.Scopes, ","))
+			"scopes", strings.Join(cfg.Scopes, ","))
 		log.Error(ctx, err, "Unable to finnish OIDC flow")
-		return &response{status: http.StatusForbidden}
+		return &response{status: http.StatusForbidden, page: accesspolicy.IdpErrorPage}
+	}
+
+	loc, err := url.Parse(claims.URL)
+	if err != nil || !isAllowedRedirect(req, loc) {
+		vals := log.MakeValues("redirect", claims.URL)
+		log.Info(ctx, vals, "Discarding disallowed redirect")
+		loc = req.url.ResolveReference(&url.URL{Path: "/"})
 	}
 
-	return srv.setToken(ctx, req, tok, claims.Path)
+	res := srv.setToken(ctx, req, tok, claims.Nonce, loc.String())
+	res.cookies = append(res.cookies, &http.Cookie{
+		Name:     cookie,
+		Path:     req.policy.Oidc.Callback.Path,
+		MaxAge:   -1,
+		HttpOnly: true,
+	})
+	return res
 }
 
 func (srv *Server) updateToken(ctx context.Context, req *request) *response {
 	log.Info(ctx, nil, "Updating JWT")
 
+	if req.session.RefreshToken == "" {
+		log.Info(ctx, nil, "Session has no refresh token")
+		return srv.restartOidc(ctx, req)
+	}
+
 	cfg := req.policy.Oidc.OAuth2(req.url)
-	src := cfg.TokenSource(ctx, &oauth2.Token{RefreshToken: req.session.RefreshToken})
+	tokCtx := req.policy.Oidc.TokenContext(ctx)
+	src := cfg.TokenSource(tokCtx, &oauth2.Token{RefreshToken: req.session.RefreshToken})
 
 	tok, err := src.Token()
 	if err != nil {
 		err = errors.Wrap(err, "failed getting access token")
 		log.Error(ctx, err, "Unable to refresh access token")
-		return &response{status: http.StatusForbidden}
+		res := srv.restartOidc(ctx, req)
+		res.refreshFailed = true
+		return res
 	}
 
-	return srv.setToken(ctx, req, tok, "")
+	return srv.setToken(ctx, req, tok, "", "")
 }
 
-func (srv *Server) setToken(ctx context.Context, req *request, token *oauth2.Token, uri string) *response {
-	data, err := req.policy.Oidc.Provider.TokenData(ctx, *token)
+func (srv *Server) restartOidc(ctx context.Context, req *request) *response {
+	log.Info(ctx, nil, "Dropping session")
+
+	sess, err := srv.Sessions.Delete(session.Stamped{Session: req.session})
 	if err != nil {
+		log.Error(ctx, err, "Unable to delete session")
+		return &response{status: http.StatusInternalServerError}
+	}
+	srv.Client.SetSession(sess)
+
+	res := srv.startOidc(ctx, req)
+	res.cookies = append(res.cookies, req.policy.Oidc.Cookie.Clear(req.url))
+	return res
+}
+
+func (srv *Server) setToken(ctx context.Context, req *request, token *oauth2.Token, nonce, uri string) *response {
+	tokCtx := req.policy.Oidc.TokenContext(ctx)
+	creds := req.policy.Oidc.Credentials()
+	data, err := req.policy.Oidc.Provider.TokenData(tokCtx, *token, nonce, req.session.IdToken, creds)
+	if errors.Is(err, openidprovider.ErrNonceMismatch) {
+		log.Error(ctx, err, "Invalid ID token")
+		return &response{status: http.StatusBadRequest}
+	} else if errors.Is(err, openidprovider.ErrMissingIdToken) {
+		log.Error(ctx, err, "Invalid token response")
+		return &response{status: http.StatusForbidden, page: accesspolicy.IdpErrorPage}
+	} else if err != nil {
 		log.Error(ctx, err, "Unable to set access token")
 		return &response{status: http.StatusInternalServerError}
 	}
@@ -165,6 +325,7 @@ func (srv *Server) setToken(ctx context.Context, req *request, token *oauth2.Tok
 	claims := bearerClaims{}
 	claims.Subject = data.Subject
 	claims.Roles = data.Roles
+	claims.Claims = data.Claims
 
 	tok, err := makeToken(req.policy.Oidc.TokenSecret, claims, token.Expiry)
 	if err != nil {
@@ -172,25 +333,41 @@ func (srv *Server) setToken(ctx context.Context, req *request, token *oauth2.Tok
 		return &response{status: http.StatusInternalServerError}
 	}
 
+	now := time.Now()
+	created := req.session.Created
+	if created.IsZero() {
+		created = now
+	}
+
+	expiry := data.Expiry
+	if maxLifetime := req.policy.Oidc.MaxLifetime; maxLifetime != 0 && expiry.After(created.Add(maxLifetime)) {
+		expiry = created.Add(maxLifetime)
+	}
+
 	hash := sha512.Sum512([]byte(tok))
 	id := string(hash[:])
 	sess := session.Stamped{
 		Session: session.Session{
 			Id:           id,
+			Issuer:       data.Issuer,
+			Subject:      data.Subject,
+			SessionId:    data.SessionId,
 			RefreshToken: token.RefreshToken,
-			Expiry:       data.Expiry,
+			IdToken:      data.IdToken,
+			Expiry:       expiry,
+			Created:      created,
+			LastSeen:     now,
 		},
 	}
+	if req.policy.ForwardsAccessToken() {
+		sess.AccessToken = token.AccessToken
+		sess.AccessTokenExpiry = token.Expiry
+	}
 	sess, _ = srv.Sessions.Set(sess)
 	srv.Client.SetSession(sess)
 
-	cookie := http.Cookie{
-		Name:     bearerCookie,
-		Value:    tok,
-		Path:     "/",
-		HttpOnly: true,
-	}
-	res := &response{headers: map[string]string{"set-cookie": cookie.String()}}
+	cookie := req.policy.Oidc.Cookie.Make(tok, req.url)
+	res := &response{headers: map[string]string{}, cookies: []*http.Cookie{cookie}}
 
 	if uri == "" {
 		res.status = http.StatusTemporaryRedirect
@@ -203,22 +380,188 @@ func (srv *Server) setToken(ctx context.Context, req *request, token *oauth2.Tok
 	return res
 }
 
+func (srv *Server) login(ctx context.Context, req *request) *response {
+	loc := req.url.ResolveReference(&url.URL{Path: "/"})
+	if redirect := req.url.Query().Get("redirect"); redirect != "" {
+		parsed, err := url.Parse(redirect)
+		if err == nil {
+			parsed = req.url.ResolveReference(parsed)
+		}
+
+		if err != nil || !isAllowedRedirect(req, parsed) || req.policy.Oidc.IsLogin(*parsed) {
+			vals := log.MakeValues("redirect", redirect)
+			log.Info(ctx, vals, "Discarding disallowed redirect")
+		} else {
+			loc = parsed
+		}
+	}
+
+	if srv.isAuthenticated(ctx, req) && !srv.isTimedOut(ctx, req) {
+		headers := map[string]string{"location": loc.String()}
+		return &response{status: http.StatusSeeOther, headers: headers}
+	}
+
+	return srv.redirectOidc(ctx, req, loc.String())
+}
+
+func (srv *Server) logout(ctx context.Context, req *request) *response {
+	log.Info(ctx, nil, "Logging out")
+
+	var idToken string
+	if srv.isAuthenticated(ctx, req) {
+		idToken = req.session.IdToken
+
+		sess, err := srv.Sessions.Delete(session.Stamped{Session: req.session})
+		if err != nil {
+			log.Error(ctx, err, "Unable to delete session")
+			return &response{status: http.StatusInternalServerError}
+		}
+		srv.Client.SetSession(sess)
+	}
+
+	res := &response{
+		status:  http.StatusSeeOther,
+		headers: map[string]string{},
+		cookies: []*http.Cookie{req.policy.Oidc.Cookie.Clear(req.url)},
+	}
+
+	redirect := req.url.ResolveReference(&url.URL{Path: "/"}).String()
+	loc, ok := req.policy.Oidc.Provider.EndSessionURL(idToken, redirect)
+	if ok {
+		res.headers["location"] = loc
+	} else {
+		log.Info(ctx, nil, "OpenID provider has no end session endpoint")
+		res.headers["location"] = redirect
+	}
+
+	return res
+}
+
+const frontChannelLogoutPage = `<!DOCTYPE html><html><head><title>Logged out</title></head><body></body></html>`
+
+func (srv *Server) frontChannelLogout(ctx context.Context, req *request) *response {
+	query := req.url.Query()
+	iss, sid := query.Get("iss"), query.Get("sid")
+	vals := log.MakeValues("iss", iss, "sid", sid)
+	log.Info(ctx, vals, "Front-channel logout")
+
+	if (sid != "" && iss == "") || (iss != "" && iss != req.policy.Oidc.Provider.Issuer()) {
+		log.Error(ctx, nil, "Invalid front-channel logout issuer")
+		return &response{status: http.StatusBadRequest}
+	}
+
+	matches := func(sess session.Session) bool {
+		return sess.SessionId == sid && sess.Issuer == iss
+	}
+
+	var current bool
+	authenticated := srv.isAuthenticated(ctx, req)
+	if sid != "" {
+		current = authenticated && matches(req.session)
+		deleted := srv.Sessions.DeleteWhere(matches)
+		for _, sess := range deleted {
+			srv.Client.SetSession(sess)
+		}
+	} else if authenticated {
+		current = true
+		sess, err := srv.Sessions.Delete(session.Stamped{Session: req.session})
+		if err != nil {
+			log.Error(ctx, err, "Unable to delete session")
+			return &response{status: http.StatusInternalServerError}
+		}
+		srv.Client.SetSession(sess)
+	}
+
+	res := &response{
+		status: http.StatusOK,
+		local:  true,
+		headers: map[string]string{
+			"content-type":  "text/html; charset=utf-8",
+			"cache-control": "no-store",
+		},
+		body: frontChannelLogoutPage,
+	}
+	if current {
+		res.cookies = []*http.Cookie{req.policy.Oidc.Cookie.Clear(req.url)}
+	}
+
+	return res
+}
+
+func isAllowedRedirect(req *request, loc *url.URL) bool {
+	if loc.Scheme != "http" && loc.Scheme != "https" {
+		return false
+	} else if loc.User != nil {
+		return false
+	} else if strings.EqualFold(loc.Host, req.url.Host) {
+		return true
+	} else {
+		return req.policy.IsRedirectHost(loc.Host)
+	}
+}
+
 func (srv *Server) authorize(ctx context.Context, req *request) *response {
 	log.Info(ctx, nil, "Authorizing")
+	srv.touch(req)
 
-	if !hasRoles(req.route.Roles, req.claims.Roles) {
+	if !hasRoles(req.route.Roles, req.route.RoleExpression, req.claims.Roles) {
 		log.Info(ctx, nil, "Denying request")
-		return &response{status: http.StatusForbidden}
+		data := &errorPageData{MissingRoles: missingRoles(req.route.Roles, req.claims.Roles)}
+		if req.route.RoleExpression != nil {
+			data.RoleExpression = req.route.RoleExpression.String()
+		}
+		return &response{status: http.StatusForbidden, pageData: data}
 	} else {
 		log.Info(ctx, nil, "Allowing request")
 	}
 
+	data := &headerData{
+		Subject: req.claims.Subject,
+		Roles:   resolveRoles(req.claims.Roles),
+		Claims:  req.claims.Claims,
+	}
+
 	headers := make(map[string]string, len(req.route.Headers))
 	for _, header := range req.route.Headers {
-		if hasRoles(header.Roles, req.claims.Roles) {
-			headers[header.Name] = header.Value
+		if !hasRoles(header.Roles, header.RoleExpression, req.claims.Roles) {
+			continue
+		}
+
+		value, err := renderHeader(header, data)
+		if err != nil {
+			log.Error(ctx, err, "Unable to render header")
+			return &response{status: http.StatusInternalServerError}
+		}
+
+		headers[header.Name] = value
+	}
+
+	if req.route.AccessTokenHeader != "" {
+		token, err := srv.accessToken(ctx, req)
+		if err != nil {
+			log.Error(ctx, err, "Unable to forward access token")
+			return &response{status: http.StatusForbidden}
 		}
+
+		headers[req.route.AccessTokenHeader] = "Bearer " + token
+	}
+
+	remove := make([]string, 0)
+	for _, header := range req.route.Headers {
+		if _, ok := headers[header.Name]; !ok {
+			remove = append(remove, header.Name)
+		}
+	}
+
+	roles := make([]interface{}, len(data.Roles))
+	for i, role := range data.Roles {
+		roles[i] = role
+	}
+	metadata := map[string]interface{}{
+		"accessPolicy": req.policy.Name,
+		"subject":      req.claims.Subject,
+		"roles":        roles,
 	}
 
-	return &response{status: http.StatusOK, headers: headers}
+	return &response{status: http.StatusOK, headers: headers, removeHeaders: remove, metadata: metadata}
 }
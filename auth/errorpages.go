@@ -0,0 +1,69 @@
+package auth
+
+import (
+	"context"
+	"github.com/KnowitSolutions/istio-oidc/log"
+	"github.com/KnowitSolutions/istio-oidc/state/accesspolicy"
+	"net/http"
+	"net/url"
+)
+
+type errorPageData struct {
+	Status         int
+	Policy         string
+	URL            string
+	Error          string
+	MissingRoles   []string
+	RoleExpression string
+	LogoutURL      string
+}
+
+func (srv *Server) errorPage(ctx context.Context, req *request, res *response) {
+	if res.body != "" {
+		return
+	}
+
+	page := res.page
+	if page == "" {
+		switch res.status {
+		case http.StatusBadRequest:
+			page = accesspolicy.BadRequestPage
+		case http.StatusForbidden:
+			page = accesspolicy.DeniedPage
+		case http.StatusInternalServerError:
+			page = accesspolicy.InternalErrorPage
+		default:
+			return
+		}
+	}
+
+	data := res.pageData
+	if data == nil {
+		data = &errorPageData{}
+	}
+	loc := req.location()
+	data.Status = res.status
+	data.Policy = req.policy.Name
+	data.URL = loc.String()
+	if req.policy.Oidc.Logout.Path != "" {
+		data.LogoutURL = req.url.ResolveReference(&url.URL{Path: req.policy.Oidc.Logout.Path}).String()
+	}
+	if !req.policy.ErrorPages.ExposeRoles {
+		data.MissingRoles = nil
+		data.RoleExpression = ""
+	}
+
+	body, contentType, err := req.policy.ErrorPages.Render(page, req.isNavigation(), data)
+	if err != nil {
+		log.Error(ctx, err, "Unable to render error page")
+		return
+	} else if body == "" {
+		return
+	}
+
+	if res.headers == nil {
+		res.headers = map[string]string{}
+	}
+	res.headers["content-type"] = contentType
+	res.body = body
+}
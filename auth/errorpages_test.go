@@ -0,0 +1,61 @@
+package auth
+
+import (
+	"context"
+	"github.com/KnowitSolutions/istio-oidc/api"
+	"github.com/KnowitSolutions/istio-oidc/state/accesspolicy"
+	core "k8s.io/api/core/v1"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func TestErrorPage(t *testing.T) {
+	tests := []struct {
+		name        string
+		exposeRoles bool
+		accept      string
+		contentType string
+		body        string
+	}{
+		{"html hidden roles", false, "text/html", "text/html; charset=utf-8", "<p>denied  </p>"},
+		{"html exposed roles", true, "text/html", "text/html; charset=utf-8", "<p>denied a, b admin AND user</p>"},
+		{"json hidden roles", false, "application/json", "application/json", `{"roles": null, "expr": ""}`},
+		{"json exposed roles", true, "application/json", "application/json", `{"roles": ["a","b"], "expr": "admin AND user"}`},
+	}
+
+	cm := &core.ConfigMap{Data: map[string]string{
+		"denied.html": `<p>denied {{join .MissingRoles ", "}} {{.RoleExpression}}</p>`,
+		"denied.json": `{"roles": {{json .MissingRoles}}, "expr": "{{.RoleExpression}}"}`,
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			pages, err := accesspolicy.NewErrorPages(api.AccessPolicyErrorPages{ExposeRoles: test.exposeRoles}, cm)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			u, _ := url.Parse("https://app.example.com/page")
+			req := &request{
+				url:     *u,
+				headers: map[string]string{"accept": test.accept},
+				policy:  &accesspolicy.AccessPolicy{Name: testPolicy, ErrorPages: pages},
+				route:   &accesspolicy.Route{},
+			}
+			res := &response{
+				status:   http.StatusForbidden,
+				pageData: &errorPageData{MissingRoles: []string{"a", "b"}, RoleExpression: "admin AND user"},
+			}
+
+			srv := &Server{}
+			srv.errorPage(context.Background(), req, res)
+			if got := res.headers["content-type"]; got != test.contentType {
+				t.Errorf("content-type = %q, want %q", got, test.contentType)
+			}
+			if res.body != test.body {
+				t.Errorf("body = %q, want %q", res.body, test.body)
+			}
+		})
+	}
+}
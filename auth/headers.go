@@ -0,0 +1,33 @@
+package auth
+
+import (
+	"github.com/KnowitSolutions/istio-oidc/log/errors"
+	"github.com/KnowitSolutions/istio-oidc/state/accesspolicy"
+	"strings"
+)
+
+type headerData struct {
+	Subject string
+	Roles   []string
+	Claims  map[string][]string
+}
+
+func renderHeader(header accesspolicy.Header, data *headerData) (string, error) {
+	if header.Template == nil {
+		return header.Value, nil
+	}
+
+	buf := &strings.Builder{}
+	err := header.Template.Execute(buf, data)
+	if err != nil {
+		return "", errors.Wrap(err, "unable to render header", "header", header.Name)
+	}
+
+	value := strings.Map(func(r rune) rune {
+		if r == '\r' || r == '\n' {
+			return -1
+		}
+		return r
+	}, buf.String())
+	return value, nil
+}
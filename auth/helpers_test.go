@@ -0,0 +1,266 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha512"
+	"encoding/json"
+	"github.com/KnowitSolutions/istio-oidc/api"
+	"github.com/KnowitSolutions/istio-oidc/config"
+	"github.com/KnowitSolutions/istio-oidc/replication"
+	"github.com/KnowitSolutions/istio-oidc/state/accesspolicy"
+	"github.com/KnowitSolutions/istio-oidc/state/openidprovider"
+	"github.com/KnowitSolutions/istio-oidc/state/session"
+	"github.com/KnowitSolutions/istio-oidc/state/usedstate"
+	"gopkg.in/square/go-jose.v2"
+	"gopkg.in/square/go-jose.v2/jwt"
+	core "k8s.io/api/core/v1"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testPolicy = "default/test"
+
+func TestMain(m *testing.M) {
+	config.Replication.Mode = config.NoneMode
+	config.Sessions.StateLifetime = 10 * time.Minute
+	config.Sessions.AccessTokenMargin = 30 * time.Second
+	config.Sessions.TouchInterval = time.Minute
+	config.Sessions.TombstoneRetention = 10 * time.Minute
+	config.Sessions.RefreshLifetime = time.Hour
+	os.Exit(m.Run())
+}
+
+type fakeIdp struct {
+	*httptest.Server
+	key *rsa.PrivateKey
+
+	mu       sync.Mutex
+	nonce    string
+	badNonce *string
+	noIdt    bool
+	verifier string
+	form     url.Values
+
+	accessToken  string
+	refreshToken string
+	expiresIn    int
+}
+
+func newFakeIdp(t *testing.T) *fakeIdp {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	idp := &fakeIdp{key: key}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 idp.URL,
+			"authorization_endpoint": idp.URL + "/authorize",
+			"token_endpoint":         idp.URL + "/token",
+			"jwks_uri":               idp.URL + "/jwks",
+			"end_session_endpoint":   idp.URL + "/logout",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		jwk := jose.JSONWebKey{Key: key.Public(), KeyID: "test", Algorithm: "RS256", Use: "sig"}
+		_ = json.NewEncoder(w).Encode(jose.JSONWebKeySet{Keys: []jose.JSONWebKey{jwk}})
+	})
+	mux.HandleFunc("/token", idp.token)
+
+	idp.Server = httptest.NewServer(mux)
+	t.Cleanup(idp.Close)
+	return idp
+}
+
+func (idp *fakeIdp) sign(t *testing.T, claims ...interface{}) string {
+	opts := (&jose.SignerOptions{}).WithHeader("kid", "test")
+	sig, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.RS256, Key: idp.key}, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	builder := jwt.Signed(sig)
+	for _, c := range claims {
+		builder = builder.Claims(c)
+	}
+
+	tok, err := builder.CompactSerialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tok
+}
+
+func (idp *fakeIdp) token(w http.ResponseWriter, r *http.Request) {
+	_ = r.ParseForm()
+
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+	idp.form = r.PostForm
+	idp.verifier = r.PostForm.Get("code_verifier")
+
+	res := map[string]interface{}{
+		"access_token":  "opaque-access-token",
+		"refresh_token": "opaque-refresh-token",
+		"token_type":    "Bearer",
+		"expires_in":    300,
+	}
+	if idp.accessToken != "" {
+		res["access_token"] = idp.accessToken
+	}
+	if idp.refreshToken != "" {
+		res["refresh_token"] = idp.refreshToken
+	}
+	if idp.expiresIn != 0 {
+		res["expires_in"] = idp.expiresIn
+	}
+
+	if !idp.noIdt {
+		claims := map[string]interface{}{
+			"iss": idp.URL,
+			"sub": "user",
+			"aud": "client",
+			"exp": time.Now().Add(time.Hour).Unix(),
+		}
+		if idp.badNonce != nil {
+			claims["nonce"] = *idp.badNonce
+		} else {
+			claims["nonce"] = idp.nonce
+		}
+
+		opts := (&jose.SignerOptions{}).WithHeader("kid", "test")
+		sig, _ := jose.NewSigner(jose.SigningKey{Algorithm: jose.RS256, Key: idp.key}, opts)
+		res["id_token"], _ = jwt.Signed(sig).Claims(claims).CompactSerialize()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(res)
+}
+
+func newTestServer(t *testing.T, idp *fakeIdp, mutate func(*api.AccessPolicy)) *Server {
+	ctx := context.Background()
+
+	spec := &api.AccessPolicy{}
+	spec.Namespace, spec.Name = "default", "test"
+	spec.Spec.Gateway = "gateway"
+	spec.Spec.OIDC.Provider = "provider"
+	spec.Spec.OIDC.CredentialsSecret.Name = "credentials"
+	if mutate != nil {
+		mutate(spec)
+	}
+
+	secret := &core.Secret{Data: map[string][]byte{
+		"clientID":     []byte("client"),
+		"clientSecret": []byte("secret"),
+		"tokenKey":     []byte(strings.Repeat("k", 64)),
+	}}
+	ap, err := accesspolicy.New(spec, secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if idp != nil {
+		op := &api.OpenIDProvider{}
+		op.Namespace, op.Name = "default", "provider"
+		op.Spec.Issuer = idp.URL
+		ap.Oidc.Provider, err = openidprovider.New(ctx, op)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	apStore := accesspolicy.NewAccessPolicyStore()
+	apStore.Update(ctx, ap)
+	sessStore, _ := session.NewSessionStore("test")
+	stateStore := usedstate.NewUsedStateStore()
+
+	return &Server{
+		Client:         replication.Client{Self: replication.NewSelf("test", sessStore, stateStore), Peers: replication.NewPeers()},
+		AccessPolicies: apStore,
+		Sessions:       sessStore,
+		UsedStates:     stateStore,
+	}
+}
+
+func (srv *Server) testCheck(t *testing.T, method, address string, headers map[string]string) *response {
+	if headers == nil {
+		headers = map[string]string{}
+	}
+
+	meta := map[string]string{accesspolicy.NameKey: testPolicy}
+	req, err := srv.newRequest(method, address, headers, meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return srv.check(context.Background(), req)
+}
+
+func cookieHeader(cookies ...*http.Cookie) string {
+	parts := make([]string, len(cookies))
+	for i, c := range cookies {
+		parts[i] = c.Name + "=" + c.Value
+	}
+	return strings.Join(parts, "; ")
+}
+
+type login struct {
+	location *url.URL
+	state    string
+	cookie   *http.Cookie
+}
+
+func startLogin(t *testing.T, srv *Server, idp *fakeIdp, address string) login {
+	res := srv.testCheck(t, http.MethodGet, address, nil)
+	if res.status != http.StatusSeeOther {
+		t.Fatalf("start login status = %d, want %d", res.status, http.StatusSeeOther)
+	}
+
+	loc, err := url.Parse(res.headers["location"])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var cookie *http.Cookie
+	for _, c := range res.cookies {
+		if strings.HasPrefix(c.Name, stateCookie+"-") {
+			cookie = c
+		}
+	}
+	if cookie == nil {
+		t.Fatal("missing state cookie")
+	}
+
+	idp.mu.Lock()
+	idp.nonce = loc.Query().Get("nonce")
+	idp.mu.Unlock()
+
+	return login{location: loc, state: loc.Query().Get("state"), cookie: cookie}
+}
+
+func (l login) callback(t *testing.T, srv *Server, cookie *http.Cookie) *response {
+	query := url.Values{"state": {l.state}, "code": {"code"}}
+	headers := map[string]string{}
+	if cookie != nil {
+		headers["cookie"] = cookieHeader(cookie)
+	}
+	return srv.testCheck(t, http.MethodGet, "https://app.example.com/odic/callback?"+query.Encode(), headers)
+}
+
+func sessionOf(t *testing.T, srv *Server, cookie *http.Cookie) session.Session {
+	hash := sha512.Sum512([]byte(cookie.Value))
+	sess, ok := srv.Sessions.Get(string(hash[:]))
+	if !ok {
+		t.Fatal("missing session")
+	}
+	return sess
+}
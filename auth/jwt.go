@@ -1,6 +1,7 @@
 package auth
 
 import (
+	"crypto/sha256"
 	"github.com/KnowitSolutions/istio-oidc/log/errors"
 	"gopkg.in/square/go-jose.v2"
 	"gopkg.in/square/go-jose.v2/jwt"
@@ -35,6 +36,28 @@ func makeToken(key []byte, claims interface{}, expiry time.Time) (string, error)
 	return str, nil
 }
 
+func makeEncryptedToken(key []byte, claims interface{}, expiry time.Time) (string, error) {
+	encKey := sha256.Sum256(key)
+	rcpt := jose.Recipient{Algorithm: jose.DIRECT, Key: encKey[:]}
+	enc, err := jose.NewEncrypter(jose.A256GCM, rcpt, nil)
+	if err != nil {
+		return "", errors.Wrap(err, "failed creating encrypter")
+	}
+	tok := jwt.Encrypted(enc).Claims(claims)
+
+	if !expiry.IsZero() {
+		def := jwt.Claims{Expiry: jwt.NewNumericDate(expiry)}
+		tok = tok.Claims(def)
+	}
+
+	str, err := tok.CompactSerialize()
+	if err != nil {
+		return "", errors.Wrap(err, "failed token serialization")
+	}
+
+	return str, nil
+}
+
 func parseToken(key []byte, tok string, claims interface{}) error {
 	parsed, err := jwt.ParseSigned(tok)
 	if err != nil {
@@ -48,3 +71,18 @@ func parseToken(key []byte, tok string, claims interface{}) error {
 
 	return nil
 }
+
+func parseEncryptedToken(key []byte, tok string, claims interface{}) error {
+	parsed, err := jwt.ParseEncrypted(tok)
+	if err != nil {
+		return errors.Wrap(err, "unable to parse JWT")
+	}
+
+	encKey := sha256.Sum256(key)
+	err = parsed.Claims(encKey[:], claims)
+	if err != nil {
+		return errors.Wrap(err, "unable to deserialize claims")
+	}
+
+	return nil
+}
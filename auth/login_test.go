@@ -0,0 +1,88 @@
+package auth
+
+import (
+	"github.com/KnowitSolutions/istio-oidc/api"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestLoginURL(t *testing.T) {
+	tests := []struct {
+		name    string
+		referer string
+		want    string
+	}{
+		{"no referer", "", "https://app.example.com/odic/login"},
+		{"same host", "https://app.example.com/page?x=1", "https://app.example.com/odic/login?redirect=" + url.QueryEscape("https://app.example.com/page?x=1")},
+		{"foreign host", "https://evil.example.com/", "https://app.example.com/odic/login"},
+		{"bad scheme", "javascript:alert(1)", "https://app.example.com/odic/login"},
+		{"user info", "https://user@app.example.com/", "https://app.example.com/odic/login"},
+	}
+
+	srv := newTestServer(t, nil, nil)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			headers := map[string]string{"accept": "application/json"}
+			if test.referer != "" {
+				headers["referer"] = test.referer
+			}
+
+			res := srv.testCheck(t, http.MethodGet, "https://app.example.com/api/x", headers)
+			if res.status != http.StatusUnauthorized {
+				t.Fatalf("status = %d, want %d", res.status, http.StatusUnauthorized)
+			}
+			if got := res.headers["www-authenticate"]; !strings.Contains(got, `login_url="`+test.want+`"`) {
+				t.Errorf("www-authenticate = %q, want login_url %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestLogin(t *testing.T) {
+	tests := []struct {
+		name     string
+		vhosts   []string
+		redirect string
+		want     string
+	}{
+		{"relative", nil, "/page?x=1", "https://app.example.com/page?x=1"},
+		{"absolute", nil, "https://app.example.com/page", "https://app.example.com/page"},
+		{"missing", nil, "", "https://app.example.com/"},
+		{"foreign host", nil, "https://evil.example.com/", "https://app.example.com/"},
+		{"protocol relative", nil, "//evil.example.com/", "https://app.example.com/"},
+		{"login path", nil, "/odic/login", "https://app.example.com/"},
+		{"virtual host", []string{"other.example.com"}, "https://other.example.com/page", "https://other.example.com/page"},
+		{"wildcard virtual host", []string{"*.example.com"}, "https://other.example.com/page", "https://other.example.com/page"},
+		{"catch-all own host", []string{"*"}, "https://app.example.com/page", "https://app.example.com/page"},
+		{"catch-all foreign host", []string{"*"}, "https://evil.example/phish", "https://app.example.com/"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			idp := newFakeIdp(t)
+			srv := newTestServer(t, idp, func(ap *api.AccessPolicy) {
+				ap.Status.VirtualHosts = test.vhosts
+			})
+
+			address := "https://app.example.com/odic/login"
+			if test.redirect != "" {
+				address += "?" + url.Values{"redirect": {test.redirect}}.Encode()
+			}
+
+			l := startLogin(t, srv, idp, address)
+			if !strings.HasPrefix(l.location.String(), idp.URL+"/authorize") {
+				t.Fatalf("location = %q, want authorization endpoint", l.location)
+			}
+
+			res := l.callback(t, srv, l.cookie)
+			if res.status != http.StatusSeeOther {
+				t.Fatalf("callback status = %d, want %d", res.status, http.StatusSeeOther)
+			}
+			if got := res.headers["location"]; got != test.want {
+				t.Errorf("callback location = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,144 @@
+package auth
+
+import (
+	"github.com/KnowitSolutions/istio-oidc/api"
+	"github.com/KnowitSolutions/istio-oidc/state/session"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFrontChannelLogout(t *testing.T) {
+	tests := []struct {
+		name    string
+		iss     string
+		sid     string
+		status  int
+		deleted []string
+	}{
+		{"matching issuer", "idp", "sid", http.StatusOK, []string{"own"}},
+		{"missing issuer", "", "sid", http.StatusBadRequest, nil},
+		{"foreign issuer", "https://other.example.com", "sid", http.StatusBadRequest, nil},
+		{"unknown session", "idp", "other", http.StatusOK, nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			idp := newFakeIdp(t)
+			srv := newTestServer(t, idp, func(ap *api.AccessPolicy) {
+				ap.Spec.OIDC.FrontChannelLogoutPath = "/fc"
+			})
+
+			expiry := time.Now().Add(time.Hour)
+			sessions := map[string]string{"own": idp.URL, "foreign": "https://other.example.com"}
+			for id, iss := range sessions {
+				sess := session.Session{Id: id, Issuer: iss, SessionId: "sid", Expiry: expiry}
+				if _, err := srv.Sessions.Set(session.Stamped{Session: sess}); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			iss := test.iss
+			if iss == "idp" {
+				iss = idp.URL
+			}
+			query := url.Values{"iss": {iss}, "sid": {test.sid}}
+			res := srv.testCheck(t, http.MethodGet, "https://app.example.com/fc?"+query.Encode(), nil)
+			if res.status != test.status {
+				t.Fatalf("status = %d, want %d", res.status, test.status)
+			}
+
+			deleted := map[string]bool{}
+			for _, id := range test.deleted {
+				deleted[id] = true
+			}
+			for id := range sessions {
+				if _, ok := srv.Sessions.Get(id); ok == deleted[id] {
+					t.Errorf("session %q present = %v, want %v", id, ok, !deleted[id])
+				}
+			}
+		})
+	}
+}
+
+func TestLogout(t *testing.T) {
+	idp := newFakeIdp(t)
+	srv := newTestServer(t, idp, func(ap *api.AccessPolicy) {
+		ap.Spec.OIDC.LogoutPath = "/logout"
+	})
+
+	l := startLogin(t, srv, idp, "https://app.example.com/odic/login")
+	cookie := l.callback(t, srv, l.cookie).cookies[0]
+	sess := sessionOf(t, srv, cookie)
+
+	headers := map[string]string{"cookie": cookieHeader(cookie)}
+	res := srv.testCheck(t, http.MethodGet, "https://app.example.com/logout", headers)
+	if res.status != http.StatusSeeOther {
+		t.Fatalf("status = %d, want %d", res.status, http.StatusSeeOther)
+	}
+
+	if len(res.cookies) != 1 || res.cookies[0].Name != cookie.Name || res.cookies[0].MaxAge >= 0 {
+		t.Errorf("cookies = %v, want %q cleared", res.cookies, cookie.Name)
+	}
+
+	loc, err := url.Parse(res.headers["location"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := loc.Query()
+	if got := loc.Scheme + "://" + loc.Host + loc.Path; got != idp.URL+"/logout" {
+		t.Errorf("location = %q, want end session endpoint", got)
+	}
+	if got := query.Get("id_token_hint"); got == "" || got != sess.IdToken {
+		t.Errorf("id_token_hint = %q, want %q", got, sess.IdToken)
+	}
+	if got := query.Get("post_logout_redirect_uri"); got != "https://app.example.com/" {
+		t.Errorf("post_logout_redirect_uri = %q, want %q", got, "https://app.example.com/")
+	}
+
+	if _, ok := srv.Sessions.Get(sess.Id); ok {
+		t.Error("session still present after logout")
+	}
+
+	var tombstone session.Stamped
+	for s := range srv.Sessions.Stream(map[string]uint64{}) {
+		if s.Id == sess.Id && s.Deleted {
+			tombstone = s
+		}
+	}
+	if !tombstone.Deleted {
+		t.Fatal("no tombstone to replicate")
+	} else if tombstone.RefreshToken != "" || tombstone.IdToken != "" {
+		t.Error("tombstone still carries tokens")
+	}
+
+	res = srv.testCheck(t, http.MethodGet, "https://app.example.com/page", headers)
+	if res.status != http.StatusSeeOther || !strings.HasPrefix(res.headers["location"], idp.URL+"/authorize") {
+		t.Errorf("after logout status = %d, location = %q, want login redirect", res.status, res.headers["location"])
+	}
+}
+
+func TestLogoutUnauthenticated(t *testing.T) {
+	idp := newFakeIdp(t)
+	srv := newTestServer(t, idp, func(ap *api.AccessPolicy) {
+		ap.Spec.OIDC.LogoutPath = "/logout"
+	})
+
+	res := srv.testCheck(t, http.MethodGet, "https://app.example.com/logout", nil)
+	if res.status != http.StatusSeeOther {
+		t.Fatalf("status = %d, want %d", res.status, http.StatusSeeOther)
+	}
+
+	loc, err := url.Parse(res.headers["location"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loc.Query()["id_token_hint"] != nil {
+		t.Errorf("location = %q, want no id_token_hint", loc)
+	}
+	if got := loc.Query().Get("post_logout_redirect_uri"); got != "https://app.example.com/" {
+		t.Errorf("post_logout_redirect_uri = %q, want %q", got, "https://app.example.com/")
+	}
+}
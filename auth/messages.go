@@ -8,14 +8,18 @@ import (
 	"net/url"
 )
 
-const bearerCookie = "bearer"
+const stateCookie = "state"
 
 type request struct {
+	method    string
 	url       url.URL
+	headers   map[string]string
 	cookies   []*http.Cookie
 	fetchMode string
 	claims    bearerClaims
 
+	accessToken string
+
 	policy  *accesspolicy.AccessPolicy
 	route   *accesspolicy.Route
 	session session.Session
@@ -24,6 +28,16 @@ type request struct {
 type response struct {
 	status  int
 	headers map[string]string
+	cookies []*http.Cookie
+	body    string
+	local   bool
+
+	removeHeaders []string
+	metadata      map[string]interface{}
+	refreshFailed bool
+
+	page     string
+	pageData *errorPageData
 }
 
 func (req *request) location() url.URL {
@@ -39,9 +53,9 @@ func (req *request) location() url.URL {
 	return loc
 }
 
-func (req *request) bearer() string {
+func (req *request) cookie(name string) string {
 	for _, c := range req.cookies {
-		if c.Name == bearerCookie {
+		if c.Name == name {
 			return c.Value
 		}
 	}
@@ -49,6 +63,10 @@ func (req *request) bearer() string {
 	return ""
 }
 
+func (req *request) bearer() string {
+	return req.cookie(req.policy.Oidc.Cookie.Name)
+}
+
 func (req *request) rawToken() string {
 	tok, err := jose.ParseSigned(req.bearer())
 	if err == nil {
@@ -11,20 +11,28 @@ var (
 		Name:      "requests",
 		Help:      "Total number of authorization requests",
 	}, []string{"policy", "type"})
-	reqAuthdCount    = reqCount.MustCurryWith(prometheus.Labels{"type": "authenticated"})
-	reqUnauthdCount  = reqCount.MustCurryWith(prometheus.Labels{"type": "unauthenticated"})
-	reqCallbackCount = reqCount.MustCurryWith(prometheus.Labels{"type": "callback"})
-	reqExpiredCount  = reqCount.MustCurryWith(prometheus.Labels{"type": "expired"})
+	reqAuthdCount         = reqCount.MustCurryWith(prometheus.Labels{"type": "authenticated"})
+	reqUnauthdCount       = reqCount.MustCurryWith(prometheus.Labels{"type": "unauthenticated"})
+	reqCallbackCount      = reqCount.MustCurryWith(prometheus.Labels{"type": "callback"})
+	reqExpiredCount       = reqCount.MustCurryWith(prometheus.Labels{"type": "expired"})
+	reqLoginCount         = reqCount.MustCurryWith(prometheus.Labels{"type": "login"})
+	reqLogoutCount        = reqCount.MustCurryWith(prometheus.Labels{"type": "logout"})
+	reqFrontChannelCount  = reqCount.MustCurryWith(prometheus.Labels{"type": "frontchannel-logout"})
+	reqBearerCount        = reqCount.MustCurryWith(prometheus.Labels{"type": "bearer"})
+	reqRefreshFailedCount = reqCount.MustCurryWith(prometheus.Labels{"type": "refresh-failed"})
+	reqTimedOutCount      = reqCount.MustCurryWith(prometheus.Labels{"type": "timed-out"})
 
 	resCount = promauto.NewCounterVec(prometheus.CounterOpts{
 		Namespace: "auth",
 		Name:      "responses",
 		Help:      "Total number of authorization responses",
 	}, []string{"policy", "result"})
-	resAllowedCount = resCount.MustCurryWith(prometheus.Labels{"result": "allowed"})
-	resDeniedCount  = resCount.MustCurryWith(prometheus.Labels{"result": "denied"})
-	resRedirCount   = resCount.MustCurryWith(prometheus.Labels{"result": "redirected"})
-	resBadReqCount  = resCount.MustCurryWith(prometheus.Labels{"result": "bad-request"})
-	resErrorCount   = resCount.MustCurryWith(prometheus.Labels{"result": "error"})
-	resOtherCount   = resCount.MustCurryWith(prometheus.Labels{"result": "other"})
+	resAllowedCount       = resCount.MustCurryWith(prometheus.Labels{"result": "allowed"})
+	resDeniedCount        = resCount.MustCurryWith(prometheus.Labels{"result": "denied"})
+	resRedirCount         = resCount.MustCurryWith(prometheus.Labels{"result": "redirected"})
+	resUnauthdCount       = resCount.MustCurryWith(prometheus.Labels{"result": "unauthenticated"})
+	resBadReqCount        = resCount.MustCurryWith(prometheus.Labels{"result": "bad-request"})
+	resErrorCount         = resCount.MustCurryWith(prometheus.Labels{"result": "error"})
+	resOtherCount         = resCount.MustCurryWith(prometheus.Labels{"result": "other"})
+	resRefreshFailedCount = resCount.MustCurryWith(prometheus.Labels{"result": "refresh-failed"})
 )
@@ -0,0 +1,41 @@
+package auth
+
+import (
+	"github.com/KnowitSolutions/istio-oidc/state/accesspolicy"
+	"net/http"
+	"testing"
+)
+
+func TestNonce(t *testing.T) {
+	empty, wrong := "", "wrong"
+	tests := []struct {
+		name     string
+		badNonce *string
+		noIdt    bool
+		want     int
+		page     string
+	}{
+		{name: "matching", want: http.StatusSeeOther},
+		{name: "mismatch", badNonce: &wrong, want: http.StatusBadRequest},
+		{name: "missing", badNonce: &empty, want: http.StatusBadRequest},
+		{name: "missing ID token", noIdt: true, want: http.StatusForbidden, page: accesspolicy.IdpErrorPage},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			idp := newFakeIdp(t)
+			srv := newTestServer(t, idp, nil)
+
+			l := startLogin(t, srv, idp, "https://app.example.com/")
+			idp.badNonce, idp.noIdt = test.badNonce, test.noIdt
+
+			res := l.callback(t, srv, l.cookie)
+			if res.status != test.want {
+				t.Fatalf("callback status = %d, want %d", res.status, test.want)
+			}
+			if res.page != test.page {
+				t.Errorf("callback page = %v, want %v", res.page, test.page)
+			}
+		})
+	}
+}
@@ -0,0 +1,21 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"github.com/KnowitSolutions/istio-oidc/log/errors"
+)
+
+func makeVerifier() (string, error) {
+	verifier, err := makeRandom()
+	if err != nil {
+		return "", errors.Wrap(err, "failed generating code verifier")
+	}
+
+	return verifier, nil
+}
+
+func makeChallenge(verifier string) string {
+	hash := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(hash[:])
+}
@@ -0,0 +1,81 @@
+package auth
+
+import (
+	"github.com/KnowitSolutions/istio-oidc/api"
+	"net/http"
+	"testing"
+)
+
+func TestMakeChallenge(t *testing.T) {
+	// RFC 7636 appendix B
+	verifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	want := "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+	if got := makeChallenge(verifier); got != want {
+		t.Errorf("makeChallenge() = %q, want %q", got, want)
+	}
+}
+
+func TestMakeVerifier(t *testing.T) {
+	a, err := makeVerifier()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := makeVerifier()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(a) < 43 || len(a) > 128 {
+		t.Errorf("verifier length = %d, want 43-128", len(a))
+	}
+	if a == b {
+		t.Errorf("verifiers are not random")
+	}
+}
+
+func TestPKCEFlow(t *testing.T) {
+	enabled, disabled := true, false
+	tests := []struct {
+		name string
+		pkce *bool
+		want bool
+	}{
+		{"enabled", &enabled, true},
+		{"disabled", &disabled, false},
+		{"provider default", nil, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			idp := newFakeIdp(t)
+			srv := newTestServer(t, idp, func(ap *api.AccessPolicy) {
+				ap.Spec.OIDC.PKCE = test.pkce
+			})
+
+			l := startLogin(t, srv, idp, "https://app.example.com/")
+			query := l.location.Query()
+			if got := query.Get("code_challenge") != ""; got != test.want {
+				t.Fatalf("code_challenge present = %v, want %v", got, test.want)
+			}
+
+			res := l.callback(t, srv, l.cookie)
+			if res.status != http.StatusSeeOther {
+				t.Fatalf("callback status = %d, want %d", res.status, http.StatusSeeOther)
+			}
+
+			if !test.want {
+				if idp.verifier != "" {
+					t.Errorf("unexpected code_verifier %q", idp.verifier)
+				}
+				return
+			}
+
+			if query.Get("code_challenge_method") != "S256" {
+				t.Errorf("code_challenge_method = %q, want S256", query.Get("code_challenge_method"))
+			}
+			if makeChallenge(idp.verifier) != query.Get("code_challenge") {
+				t.Errorf("code_verifier does not match code_challenge")
+			}
+		})
+	}
+}
@@ -0,0 +1,16 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+)
+
+func makeRandom() (string, error) {
+	var buf [32]byte
+	_, err := rand.Read(buf[:])
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(buf[:]), nil
+}
@@ -1,21 +1,14 @@
 package auth
 
-func hasRoles(required []string, provided map[string][]string) bool {
-	count := 0
-	for _, v := range provided {
-		count += len(v)
-	}
+import (
+	"github.com/KnowitSolutions/istio-oidc/state/accesspolicy"
+	"sort"
+)
 
-	resolved := make([]string, 0, count)
-	for k, v := range provided {
-		prefixed := make([]string, len(v))
-		for i, v := range v {
-			prefixed[i] = k + v
-		}
-		resolved = append(resolved, prefixed...)
-	}
+func hasRoles(required []string, expr *accesspolicy.RoleExpression, provided map[string][]string) bool {
+	resolved := resolveRoles(provided)
 
-	found := make(map[string]bool, len(provided))
+	found := make(map[string]bool, len(resolved))
 	for _, k := range resolved {
 		found[k] = true
 	}
@@ -28,5 +21,44 @@ func hasRoles(required []string, provided map[string][]string) bool {
 		}
 	}
 
+	if allow && expr != nil {
+		allow = expr.Matches(found)
+	}
+
 	return allow
 }
+
+func missingRoles(required []string, provided map[string][]string) []string {
+	found := make(map[string]bool)
+	for _, k := range resolveRoles(provided) {
+		found[k] = true
+	}
+
+	missing := make([]string, 0)
+	for _, v := range required {
+		if !found[v] {
+			missing = append(missing, v)
+		}
+	}
+
+	return missing
+}
+
+func resolveRoles(provided map[string][]string) []string {
+	count := 0
+	for _, v := range provided {
+		count += len(v)
+	}
+
+	resolved := make([]string, 0, count)
+	for k, v := range provided {
+		prefixed := make([]string, len(v))
+		for i, v := range v {
+			prefixed[i] = k + v
+		}
+		resolved = append(resolved, prefixed...)
+	}
+
+	sort.Strings(resolved)
+	return resolved
+}
@@ -5,24 +5,38 @@ import (
 	"github.com/KnowitSolutions/istio-oidc/replication"
 	"github.com/KnowitSolutions/istio-oidc/state/accesspolicy"
 	"github.com/KnowitSolutions/istio-oidc/state/session"
+	"github.com/KnowitSolutions/istio-oidc/state/usedstate"
 	"net/http"
 	"net/url"
+	"path"
+	"strings"
 )
 
 type Server struct {
 	replication.Client
 	AccessPolicies accesspolicy.Store
 	Sessions       session.Store
+	UsedStates     usedstate.Store
 }
 
 func (srv *Server) V2() *ServerV2 {
 	return &ServerV2{Server: srv}
 }
 
-func (srv *Server) newRequest(address, cookies, fetchMode string, metadata map[string]string) (*request, error) {
+func (srv *Server) V3() *ServerV3 {
+	return &ServerV3{Server: srv}
+}
+
+func (srv *Server) HTTP() *ServerHTTP {
+	return &ServerHTTP{Server: srv}
+}
+
+func (srv *Server) newRequest(method, address string, headers, metadata map[string]string) (*request, error) {
 	parsed, err := url.Parse(address)
 	if err != nil {
 		return nil, errors.Wrap(err, "unable to parse address", "address", address)
+	} else if !isCleanPath(parsed.Path) {
+		return nil, errors.New("non-canonical path", "path", parsed.Path)
 	}
 
 	ap := srv.AccessPolicies.Get(metadata[accesspolicy.NameKey])
@@ -32,20 +46,34 @@ func (srv *Server) newRequest(address, cookies, fetchMode string, metadata map[s
 
 	route, ok := ap.Routes[metadata[accesspolicy.RouteKey]]
 	if metadata[accesspolicy.RouteKey] == "" {
-		route = ap.Default
+		route = ap.MatchRoute(method, parsed.Path)
 	} else if !ok {
 		return nil, errors.New("unknown route", "AccessPolicy", metadata[accesspolicy.NameKey])
 	}
 
 	req := http.Request{Header: http.Header{}}
-	req.Header.Add("Cookie", cookies)
+	req.Header.Add("Cookie", headers["cookie"])
 
 	return &request{
+		method:    method,
 		url:       *parsed,
+		headers:   headers,
 		cookies:   req.Cookies(),
-		fetchMode: fetchMode,
+		fetchMode: headers["sec-fetch-mode"],
 
 		policy: ap,
 		route:  &route,
 	}, nil
 }
+
+func isCleanPath(p string) bool {
+	if p == "" {
+		return true
+	}
+
+	clean := path.Clean(p)
+	if strings.HasSuffix(p, "/") && clean != "/" {
+		clean += "/"
+	}
+	return clean == p
+}
@@ -0,0 +1,67 @@
+package auth
+
+import (
+	"github.com/KnowitSolutions/istio-oidc/api"
+	"github.com/KnowitSolutions/istio-oidc/state/accesspolicy"
+	"net/http"
+	"testing"
+)
+
+func TestNewRequestPath(t *testing.T) {
+	tests := []struct {
+		name    string
+		address string
+		valid   bool
+	}{
+		{"root", "https://app.example.com/", true},
+		{"empty", "https://app.example.com", true},
+		{"plain", "https://app.example.com/admin/x", true},
+		{"trailing slash", "https://app.example.com/admin/", true},
+		{"dot dot", "https://app.example.com/static/../admin/x", false},
+		{"encoded dot dot", "https://app.example.com/static/%2e%2e/admin/x", false},
+		{"dot", "https://app.example.com/./admin/x", false},
+		{"double slash", "https://app.example.com//admin", false},
+		{"inner double slash", "https://app.example.com/static//admin", false},
+	}
+
+	srv := newTestServer(t, nil, nil)
+	meta := map[string]string{accesspolicy.NameKey: testPolicy}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := srv.newRequest(http.MethodGet, test.address, map[string]string{}, meta)
+			if valid := err == nil; valid != test.valid {
+				t.Errorf("newRequest() error = %v, want valid %v", err, test.valid)
+			}
+		})
+	}
+}
+
+func TestNewRequestRoute(t *testing.T) {
+	srv := newTestServer(t, nil, func(ap *api.AccessPolicy) {
+		ap.Spec.Routes = []api.AccessPolicyRoute{
+			{Match: &api.AccessPolicyRouteMatch{Prefix: "/static/"}, DisableEnforcement: true},
+		}
+	})
+
+	tests := []struct {
+		name    string
+		address string
+		public  bool
+	}{
+		{"static", "https://app.example.com/static/x", true},
+		{"admin", "https://app.example.com/admin/x", false},
+	}
+
+	meta := map[string]string{accesspolicy.NameKey: testPolicy}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req, err := srv.newRequest(http.MethodGet, test.address, map[string]string{}, meta)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if req.route.EnableAuthz == test.public {
+				t.Errorf("route enforced = %v, want %v", req.route.EnableAuthz, !test.public)
+			}
+		})
+	}
+}
@@ -0,0 +1,156 @@
+package auth
+
+import (
+	"fmt"
+	"github.com/KnowitSolutions/istio-oidc/config"
+	"github.com/KnowitSolutions/istio-oidc/log"
+	"github.com/KnowitSolutions/istio-oidc/log/errors"
+	"github.com/KnowitSolutions/istio-oidc/state/accesspolicy"
+	"net/http"
+	"strings"
+)
+
+const (
+	ForwardAuthPath       = "/forward-auth/"
+	AuthRequestPath       = "/auth-request/"
+	BackChannelLogoutPath = "/backchannel-logout/"
+)
+
+type ServerHTTP struct {
+	*Server
+}
+
+func (srv *ServerHTTP) ServeHTTP(writer http.ResponseWriter, req *http.Request) {
+	ctx := tracingCtx(req.Context())
+
+	var nginx bool
+	var params string
+	if strings.HasPrefix(req.URL.Path, BackChannelLogoutPath) {
+		params = strings.TrimPrefix(req.URL.Path, BackChannelLogoutPath)
+		srv.backChannelLogout(ctx, writer, req, params)
+		return
+	} else if strings.HasPrefix(req.URL.Path, AuthRequestPath) {
+		nginx = true
+		params = strings.TrimPrefix(req.URL.Path, AuthRequestPath)
+	} else if strings.HasPrefix(req.URL.Path, ForwardAuthPath) {
+		params = strings.TrimPrefix(req.URL.Path, ForwardAuthPath)
+	} else {
+		http.NotFound(writer, req)
+		return
+	}
+
+	headers := make(map[string]string, len(req.Header))
+	for k, v := range req.Header {
+		k = strings.ToLower(k)
+		if k == "cookie" {
+			headers[k] = strings.Join(v, "; ")
+		} else {
+			headers[k] = strings.Join(v, ", ")
+		}
+	}
+
+	meta := forwardAuthMetadata(params, headers)
+	addr, err := originalURL(req, nginx)
+	var data *request
+	if err == nil {
+		data, err = srv.newRequest(originalMethod(req, nginx), addr, headers, meta)
+	}
+
+	var r *response
+	if err != nil {
+		log.Error(ctx, err, "Unable to construct request object")
+		r = &response{status: http.StatusBadRequest}
+	} else {
+		r = srv.check(ctx, data)
+	}
+
+	for k, v := range r.headers {
+		writer.Header().Set(k, v)
+	}
+	for _, c := range r.cookies {
+		writer.Header().Add("set-cookie", c.String())
+	}
+
+	// Proxies treat any 2xx as allowing the request upstream, so responses
+	// generated locally have to be terminal
+	status := r.status
+	if status == http.StatusOK && r.local {
+		status = http.StatusForbidden
+	} else if nginx && (status == http.StatusSeeOther || status == http.StatusTemporaryRedirect) {
+		status = http.StatusUnauthorized
+	}
+
+	writer.WriteHeader(status)
+	if r.body != "" {
+		_, err = writer.Write([]byte(r.body))
+		if err != nil {
+			log.Error(ctx, err, "Unable to write response body")
+		}
+	}
+}
+
+func forwardAuthMetadata(params string, headers map[string]string) map[string]string {
+	parts := strings.Split(strings.Trim(params, "/"), "/")
+	switch len(parts) {
+	case 2:
+		return map[string]string{accesspolicy.NameKey: parts[0] + "/" + parts[1]}
+	case 3:
+		return map[string]string{
+			accesspolicy.NameKey:  parts[0] + "/" + parts[1],
+			accesspolicy.RouteKey: parts[2],
+		}
+	default:
+		meta := map[string]string{}
+		if config.HTTP.PolicyHeader != "" {
+			meta[accesspolicy.NameKey] = headers[config.HTTP.PolicyHeader]
+		}
+		if config.HTTP.RouteHeader != "" {
+			meta[accesspolicy.RouteKey] = headers[config.HTTP.RouteHeader]
+		}
+		return meta
+	}
+}
+
+// nginx auth_request passes the original request in X-Original-* headers,
+// while Traefik forwardAuth uses X-Forwarded-*. Only the headers belonging to
+// the endpoint that was called are trusted.
+func originalURL(req *http.Request, nginx bool) (string, error) {
+	if nginx {
+		addr := req.Header.Get("X-Original-URL")
+		if addr == "" {
+			return "", errors.New("missing X-Original-URL header")
+		}
+		return addr, nil
+	}
+
+	proto := req.Header.Get("X-Forwarded-Proto")
+	if proto == "" {
+		proto = "http"
+	}
+
+	host := req.Header.Get("X-Forwarded-Host")
+	if host == "" {
+		host = req.Host
+	}
+
+	uri := req.Header.Get("X-Forwarded-Uri")
+	if uri == "" {
+		uri = "/"
+	}
+
+	return fmt.Sprintf("%s://%s%s", proto, host, uri), nil
+}
+
+func originalMethod(req *http.Request, nginx bool) string {
+	var method string
+	if nginx {
+		method = req.Header.Get("X-Original-Method")
+	} else {
+		method = req.Header.Get("X-Forwarded-Method")
+	}
+
+	if method == "" {
+		return http.MethodGet
+	}
+	return method
+}
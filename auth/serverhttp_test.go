@@ -0,0 +1,211 @@
+package auth
+
+import (
+	"github.com/KnowitSolutions/istio-oidc/api"
+	"github.com/KnowitSolutions/istio-oidc/config"
+	"github.com/KnowitSolutions/istio-oidc/state/accesspolicy"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestOriginalRequest(t *testing.T) {
+	tests := []struct {
+		name    string
+		nginx   bool
+		headers map[string]string
+		url     string
+		method  string
+		err     bool
+	}{
+		{
+			name:    "nginx",
+			nginx:   true,
+			headers: map[string]string{"X-Original-URL": "https://app.example.com/x", "X-Original-Method": "POST"},
+			url:     "https://app.example.com/x",
+			method:  "POST",
+		},
+		{
+			name:  "nginx ignores forwarded",
+			nginx: true,
+			headers: map[string]string{
+				"X-Forwarded-Proto":  "https",
+				"X-Forwarded-Host":   "app.example.com",
+				"X-Forwarded-Uri":    "/x",
+				"X-Forwarded-Method": "POST",
+			},
+			err: true,
+		},
+		{
+			name: "forward auth",
+			headers: map[string]string{
+				"X-Forwarded-Proto":  "https",
+				"X-Forwarded-Host":   "app.example.com",
+				"X-Forwarded-Uri":    "/x",
+				"X-Forwarded-Method": "POST",
+			},
+			url:    "https://app.example.com/x",
+			method: "POST",
+		},
+		{
+			name: "forward auth ignores original",
+			headers: map[string]string{
+				"X-Original-URL":    "https://evil.example.com/admin",
+				"X-Original-URI":    "/admin",
+				"X-Original-Method": "POST",
+			},
+			url:    "http://auth.local/",
+			method: "GET",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "http://auth.local/", nil)
+			for k, v := range test.headers {
+				req.Header.Set(k, v)
+			}
+
+			url, err := originalURL(req, test.nginx)
+			if test.err {
+				if err == nil {
+					t.Fatalf("originalURL() = %q, want error", url)
+				}
+				return
+			} else if err != nil {
+				t.Fatal(err)
+			}
+
+			if url != test.url {
+				t.Errorf("originalURL() = %q, want %q", url, test.url)
+			}
+			if method := originalMethod(req, test.nginx); method != test.method {
+				t.Errorf("originalMethod() = %q, want %q", method, test.method)
+			}
+		})
+	}
+}
+
+func TestForwardAuthMetadata(t *testing.T) {
+	defer func(policy, route string) {
+		config.HTTP.PolicyHeader, config.HTTP.RouteHeader = policy, route
+	}(config.HTTP.PolicyHeader, config.HTTP.RouteHeader)
+
+	headers := map[string]string{
+		"x-access-policy":       "default/other",
+		"x-access-policy-route": "other",
+		"x-policy":              "default/trusted",
+		"x-route":               "trusted",
+	}
+
+	tests := []struct {
+		name         string
+		params       string
+		policyHeader string
+		routeHeader  string
+		want         map[string]string
+	}{
+		{
+			name:   "path policy",
+			params: "default/test",
+			want:   map[string]string{accesspolicy.NameKey: "default/test"},
+		},
+		{
+			name:   "path route",
+			params: "default/test/route/",
+			want:   map[string]string{accesspolicy.NameKey: "default/test", accesspolicy.RouteKey: "route"},
+		},
+		{
+			name:         "path overrides header",
+			params:       "default/test",
+			policyHeader: "x-policy",
+			want:         map[string]string{accesspolicy.NameKey: "default/test"},
+		},
+		{
+			name: "untrusted header",
+			want: map[string]string{},
+		},
+		{
+			name:         "trusted header",
+			policyHeader: "x-policy",
+			routeHeader:  "x-route",
+			want:         map[string]string{accesspolicy.NameKey: "default/trusted", accesspolicy.RouteKey: "trusted"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config.HTTP.PolicyHeader = test.policyHeader
+			config.HTTP.RouteHeader = test.routeHeader
+
+			got := forwardAuthMetadata(test.params, headers)
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("forwardAuthMetadata() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestForwardAuthStatus(t *testing.T) {
+	tests := []struct {
+		name    string
+		path    string
+		headers map[string]string
+		want    int
+		body    bool
+	}{
+		{
+			name:    "public route",
+			path:    ForwardAuthPath + "default/test",
+			headers: map[string]string{"X-Forwarded-Proto": "https", "X-Forwarded-Host": "app.example.com", "X-Forwarded-Uri": "/public/x"},
+			want:    http.StatusOK,
+		},
+		{
+			name:    "local response",
+			path:    ForwardAuthPath + "default/test",
+			headers: map[string]string{"X-Forwarded-Proto": "https", "X-Forwarded-Host": "app.example.com", "X-Forwarded-Uri": "/fc"},
+			want:    http.StatusForbidden,
+			body:    true,
+		},
+		{
+			name:    "nginx local response",
+			path:    AuthRequestPath + "default/test",
+			headers: map[string]string{"X-Original-URL": "https://app.example.com/fc"},
+			want:    http.StatusForbidden,
+			body:    true,
+		},
+		{
+			name:    "nginx redirect",
+			path:    AuthRequestPath + "default/test",
+			headers: map[string]string{"X-Original-URL": "https://app.example.com/private"},
+			want:    http.StatusUnauthorized,
+		},
+	}
+
+	idp := newFakeIdp(t)
+	srv := newTestServer(t, idp, func(ap *api.AccessPolicy) {
+		ap.Spec.OIDC.FrontChannelLogoutPath = "/fc"
+		ap.Spec.Routes = []api.AccessPolicyRoute{
+			{Match: &api.AccessPolicyRouteMatch{Prefix: "/public/"}, DisableEnforcement: true},
+		}
+	})
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "http://auth.local"+test.path, nil)
+			for k, v := range test.headers {
+				req.Header.Set(k, v)
+			}
+
+			rec := httptest.NewRecorder()
+			srv.HTTP().ServeHTTP(rec, req)
+			if rec.Code != test.want {
+				t.Errorf("status = %d, want %d", rec.Code, test.want)
+			}
+			if got := rec.Body.Len() > 0; got != test.body {
+				t.Errorf("body present = %v, want %v", got, test.body)
+			}
+		})
+	}
+}
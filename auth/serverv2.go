@@ -21,14 +21,14 @@ type ServerV2 struct {
 func (srv *ServerV2) Check(ctx context.Context, req *auth.CheckRequest) (*auth.CheckResponse, error) {
 	ctx = tracingCtx(ctx)
 
-	proto := req.Attributes.Request.Http.Headers["x-forwarded-proto"]
+	headers := req.Attributes.Request.Http.Headers
+	proto := headers["x-forwarded-proto"]
 	host := req.Attributes.Request.Http.Host
 	path := req.Attributes.Request.Http.Path
 	addr := fmt.Sprintf("%s://%s%s", proto, host, path)
-	cookies := req.Attributes.Request.Http.Headers["cookie"]
-	fetchMode := req.Attributes.Request.Http.Headers["sec-fetch-mode"]
+	method := req.Attributes.Request.Http.Method
 	meta := req.Attributes.ContextExtensions
-	data, err := srv.newRequest(addr, cookies, fetchMode, meta)
+	data, err := srv.newRequest(method, addr, headers, meta)
 
 	var r *response
 	if err != nil {
@@ -38,10 +38,23 @@ func (srv *ServerV2) Check(ctx context.Context, req *auth.CheckRequest) (*auth.C
 		r = srv.check(ctx, data)
 	}
 
-	res := &auth.CheckResponse{}
-	hs := make([]*core.HeaderValueOption, len(r.headers))
+	hs := make([]*core.HeaderValueOption, 0, len(r.headers)+len(r.cookies))
+	for k, v := range r.headers {
+		hs = append(hs, &core.HeaderValueOption{
+			Header: &core.HeaderValue{Key: k, Value: v},
+			Append: &wrappers.BoolValue{Value: false},
+		})
+	}
+
+	for _, c := range r.cookies {
+		hs = append(hs, &core.HeaderValueOption{
+			Header: &core.HeaderValue{Key: "set-cookie", Value: c.String()},
+			Append: &wrappers.BoolValue{Value: true},
+		})
+	}
 
-	if r.status == http.StatusOK {
+	res := &auth.CheckResponse{}
+	if r.status == http.StatusOK && !r.local {
 		res.Status = &status.Status{Code: int32(code.Code_OK)}
 		res.HttpResponse = &auth.CheckResponse_OkResponse{
 			OkResponse: &auth.OkHttpResponse{Headers: hs},
@@ -52,18 +65,10 @@ func (srv *ServerV2) Check(ctx context.Context, req *auth.CheckRequest) (*auth.C
 			DeniedResponse: &auth.DeniedHttpResponse{
 				Status:  &types.HttpStatus{Code: types.StatusCode(r.status)},
 				Headers: hs,
+				Body:    r.body,
 			},
 		}
 	}
 
-	i := 0
-	for k, v := range r.headers {
-		hs[i] = &core.HeaderValueOption{
-			Header: &core.HeaderValue{Key: k, Value: v},
-			Append: &wrappers.BoolValue{Value: false},
-		}
-		i++
-	}
-
 	return res, nil
 }
@@ -0,0 +1,87 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"github.com/KnowitSolutions/istio-oidc/log"
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	auth "github.com/envoyproxy/go-control-plane/envoy/service/auth/v3"
+	types "github.com/envoyproxy/go-control-plane/envoy/type/v3"
+	"github.com/golang/protobuf/ptypes/wrappers"
+	"google.golang.org/genproto/googleapis/rpc/code"
+	"google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+	"net/http"
+)
+
+type ServerV3 struct {
+	auth.UnimplementedAuthorizationServer
+	*Server
+}
+
+func (srv *ServerV3) Check(ctx context.Context, req *auth.CheckRequest) (*auth.CheckResponse, error) {
+	ctx = tracingCtx(ctx)
+
+	headers := req.Attributes.Request.Http.Headers
+	proto := headers["x-forwarded-proto"]
+	host := req.Attributes.Request.Http.Host
+	path := req.Attributes.Request.Http.Path
+	addr := fmt.Sprintf("%s://%s%s", proto, host, path)
+	method := req.Attributes.Request.Http.Method
+	meta := req.Attributes.ContextExtensions
+	data, err := srv.newRequest(method, addr, headers, meta)
+
+	var r *response
+	if err != nil {
+		log.Error(ctx, err, "Unable to construct request object")
+		r = &response{status: http.StatusBadRequest}
+	} else {
+		r = srv.check(ctx, data)
+	}
+
+	hs := make([]*core.HeaderValueOption, 0, len(r.headers))
+	for k, v := range r.headers {
+		hs = append(hs, &core.HeaderValueOption{
+			Header: &core.HeaderValue{Key: k, Value: v},
+			Append: &wrappers.BoolValue{Value: false},
+		})
+	}
+
+	cs := make([]*core.HeaderValueOption, 0, len(r.cookies))
+	for _, c := range r.cookies {
+		cs = append(cs, &core.HeaderValueOption{
+			Header: &core.HeaderValue{Key: "set-cookie", Value: c.String()},
+			Append: &wrappers.BoolValue{Value: true},
+		})
+	}
+
+	res := &auth.CheckResponse{}
+	if r.metadata != nil {
+		res.DynamicMetadata, err = structpb.NewStruct(r.metadata)
+		if err != nil {
+			log.Error(ctx, err, "Unable to encode dynamic metadata")
+		}
+	}
+
+	if r.status == http.StatusOK && !r.local {
+		res.Status = &status.Status{Code: int32(code.Code_OK)}
+		res.HttpResponse = &auth.CheckResponse_OkResponse{
+			OkResponse: &auth.OkHttpResponse{
+				Headers:              hs,
+				HeadersToRemove:      r.removeHeaders,
+				ResponseHeadersToAdd: cs,
+			},
+		}
+	} else {
+		res.Status = &status.Status{Code: int32(code.Code_PERMISSION_DENIED)}
+		res.HttpResponse = &auth.CheckResponse_DeniedResponse{
+			DeniedResponse: &auth.DeniedHttpResponse{
+				Status:  &types.HttpStatus{Code: types.StatusCode(r.status)},
+				Headers: append(hs, cs...),
+				Body:    r.body,
+			},
+		}
+	}
+
+	return res, nil
+}
@@ -0,0 +1,88 @@
+package auth
+
+import (
+	"github.com/KnowitSolutions/istio-oidc/config"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestLoginState(t *testing.T) {
+	tests := []struct {
+		name     string
+		lifetime time.Duration
+		tamper   func(*login)
+		cookie   func(login) *http.Cookie
+		want     int
+	}{
+		{
+			name:   "valid",
+			cookie: func(l login) *http.Cookie { return l.cookie },
+			want:   http.StatusSeeOther,
+		},
+		{
+			name:     "expired",
+			lifetime: -time.Minute,
+			cookie:   func(l login) *http.Cookie { return l.cookie },
+			want:     http.StatusBadRequest,
+		},
+		{
+			name:   "missing binding",
+			cookie: func(l login) *http.Cookie { return nil },
+			want:   http.StatusBadRequest,
+		},
+		{
+			name: "wrong binding",
+			cookie: func(l login) *http.Cookie {
+				return &http.Cookie{Name: l.cookie.Name, Value: "wrong"}
+			},
+			want: http.StatusBadRequest,
+		},
+		{
+			name:   "tampered",
+			tamper: func(l *login) { l.state = l.state[:len(l.state)-2] + "AA" },
+			cookie: func(l login) *http.Cookie { return l.cookie },
+			want:   http.StatusBadRequest,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			idp := newFakeIdp(t)
+			srv := newTestServer(t, idp, nil)
+
+			if test.lifetime != 0 {
+				defer func(d time.Duration) { config.Sessions.StateLifetime = d }(config.Sessions.StateLifetime)
+				config.Sessions.StateLifetime = test.lifetime
+			}
+
+			l := startLogin(t, srv, idp, "https://app.example.com/page?x=1")
+			if test.tamper != nil {
+				test.tamper(&l)
+			}
+
+			res := l.callback(t, srv, test.cookie(l))
+			if res.status != test.want {
+				t.Fatalf("callback status = %d, want %d", res.status, test.want)
+			}
+		})
+	}
+}
+
+func TestLoginStateSingleUse(t *testing.T) {
+	idp := newFakeIdp(t)
+	srv := newTestServer(t, idp, nil)
+	l := startLogin(t, srv, idp, "https://app.example.com/page")
+
+	res := l.callback(t, srv, l.cookie)
+	if res.status != http.StatusSeeOther {
+		t.Fatalf("first callback status = %d, want %d", res.status, http.StatusSeeOther)
+	} else if res.headers["location"] != "https://app.example.com/page" {
+		t.Errorf("first callback location = %q", res.headers["location"])
+	}
+
+	res = l.callback(t, srv, l.cookie)
+	if res.status != http.StatusBadRequest {
+		t.Fatalf("replayed callback status = %d, want %d", res.status, http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,45 @@
+package auth
+
+import (
+	"context"
+	"github.com/KnowitSolutions/istio-oidc/config"
+	"github.com/KnowitSolutions/istio-oidc/log"
+	"time"
+)
+
+func (srv *Server) isTimedOut(ctx context.Context, req *request) bool {
+	now := time.Now()
+	oidc := req.policy.Oidc
+	sess := req.session
+
+	if oidc.MaxLifetime != 0 && !sess.Created.IsZero() && now.After(sess.Created.Add(oidc.MaxLifetime)) {
+		log.Info(ctx, nil, "Session exceeded maximum lifetime")
+		return true
+	} else if oidc.IdleTimeout != 0 && !sess.LastSeen.IsZero() && now.After(sess.LastSeen.Add(oidc.IdleTimeout)) {
+		log.Info(ctx, nil, "Session exceeded idle timeout")
+		return true
+	} else {
+		return false
+	}
+}
+
+func (srv *Server) touch(req *request) {
+	now := time.Now()
+	if req.session.Id == "" || now.Sub(req.session.LastSeen) < touchInterval(req) {
+		return
+	}
+
+	if srv.Sessions.Touch(req.session.Id, now) {
+		srv.Client.TouchSession(req.session.Id, now)
+	}
+}
+
+// Touching less often than half the idle timeout would let active sessions
+// time out between touches
+func touchInterval(req *request) time.Duration {
+	interval := config.Sessions.TouchInterval
+	if idle := req.policy.Oidc.IdleTimeout / 2; idle != 0 && idle < interval {
+		interval = idle
+	}
+	return interval
+}
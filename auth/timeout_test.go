@@ -0,0 +1,99 @@
+package auth
+
+import (
+	"context"
+	"github.com/KnowitSolutions/istio-oidc/api"
+	"github.com/KnowitSolutions/istio-oidc/state/accesspolicy"
+	"github.com/KnowitSolutions/istio-oidc/state/session"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestIsTimedOut(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name        string
+		idleTimeout time.Duration
+		maxLifetime time.Duration
+		created     time.Time
+		lastSeen    time.Time
+		want        bool
+	}{
+		{"no limits", 0, 0, now.Add(-time.Hour), now.Add(-time.Hour), false},
+		{"idle", time.Minute, 0, now.Add(-time.Hour), now.Add(-2 * time.Minute), true},
+		{"active", time.Minute, 0, now.Add(-time.Hour), now.Add(-30 * time.Second), false},
+		{"lifetime exceeded", 0, time.Hour, now.Add(-2 * time.Hour), now, true},
+		{"lifetime remaining", 0, time.Hour, now.Add(-30 * time.Minute), now, false},
+		{"unknown times", time.Minute, time.Hour, time.Time{}, time.Time{}, false},
+	}
+
+	srv := &Server{}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := &request{
+				policy:  &accesspolicy.AccessPolicy{Oidc: accesspolicy.Oidc{IdleTimeout: test.idleTimeout, MaxLifetime: test.maxLifetime}},
+				session: session.Session{Created: test.created, LastSeen: test.lastSeen},
+			}
+			if got := srv.isTimedOut(context.Background(), req); got != test.want {
+				t.Errorf("isTimedOut() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestTouch(t *testing.T) {
+	tests := []struct {
+		name        string
+		idleTimeout time.Duration
+		lastSeen    time.Duration
+		want        bool
+	}{
+		{"recent", 0, 30 * time.Second, false},
+		{"touch interval", 0, 2 * time.Minute, true},
+		{"half idle timeout", time.Minute, 45 * time.Second, true},
+		{"within half idle timeout", time.Minute, 15 * time.Second, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			srv := newTestServer(t, nil, nil)
+			lastSeen := time.Now().Add(-test.lastSeen)
+			sess := session.Session{Id: "id", Expiry: time.Now().Add(time.Hour), LastSeen: lastSeen}
+			if _, err := srv.Sessions.Set(session.Stamped{Session: sess}); err != nil {
+				t.Fatal(err)
+			}
+
+			req := &request{
+				policy:  &accesspolicy.AccessPolicy{Oidc: accesspolicy.Oidc{IdleTimeout: test.idleTimeout}},
+				session: sess,
+			}
+			srv.touch(req)
+
+			got, _ := srv.Sessions.Get("id")
+			if touched := got.LastSeen.After(lastSeen); touched != test.want {
+				t.Errorf("touched = %v, want %v", touched, test.want)
+			}
+		})
+	}
+}
+
+func TestMaxLifetime(t *testing.T) {
+	idp := newFakeIdp(t)
+	srv := newTestServer(t, idp, func(ap *api.AccessPolicy) {
+		ap.Spec.OIDC.MaxLifetime = meta.Duration{Duration: 10 * time.Minute}
+	})
+
+	l := startLogin(t, srv, idp, "https://app.example.com/odic/login")
+	res := l.callback(t, srv, l.cookie)
+	if res.status != http.StatusSeeOther {
+		t.Fatalf("callback status = %d, want %d", res.status, http.StatusSeeOther)
+	}
+
+	sess := sessionOf(t, srv, res.cookies[0])
+	if want := sess.Created.Add(10 * time.Minute); !sess.Expiry.Equal(want) {
+		t.Errorf("expiry = %v, want %v", sess.Expiry, want)
+	}
+}
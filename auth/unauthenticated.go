@@ -0,0 +1,80 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/KnowitSolutions/istio-oidc/log"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+type unauthenticatedBody struct {
+	Error    string `json:"error"`
+	LoginURL string `json:"login_url"`
+}
+
+func (req *request) isNavigation() bool {
+	switch req.fetchMode {
+	case "":
+	case "navigate":
+	case "nested-navigate":
+	default:
+		return false
+	}
+
+	if strings.EqualFold(req.headers["x-requested-with"], "XMLHttpRequest") {
+		return false
+	}
+
+	accept := req.headers["accept"]
+	if accept != "" && !strings.Contains(accept, "text/html") && !strings.Contains(accept, "*/*") {
+		return false
+	}
+
+	for _, rule := range req.route.Unauthenticated.APIHeaders {
+		value, ok := req.headers[rule.Name]
+		if ok && (rule.Regex == nil || rule.Regex.MatchString(value)) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (srv *Server) unauthenticated(ctx context.Context, req *request) *response {
+	log.Info(ctx, nil, "Skipping OIDC for non-navigation request")
+
+	cfg := req.route.Unauthenticated
+	res := &response{status: cfg.Status, headers: map[string]string{}}
+	if cfg.Status == http.StatusUnauthorized {
+		res.headers["www-authenticate"] = fmt.Sprintf("Bearer realm=%q, login_url=%q", req.policy.Name, loginURL(req))
+	}
+
+	if cfg.Format == "json" {
+		body, err := json.Marshal(unauthenticatedBody{
+			Error:    "unauthenticated",
+			LoginURL: loginURL(req),
+		})
+		if err != nil {
+			log.Error(ctx, err, "Unable to render unauthenticated response")
+			return &response{status: http.StatusInternalServerError}
+		}
+
+		res.headers["content-type"] = "application/json"
+		res.body = string(body)
+	}
+
+	return res
+}
+
+func loginURL(req *request) string {
+	login := req.url.ResolveReference(&url.URL{Path: req.policy.Oidc.Login.Path})
+
+	loc, err := url.Parse(req.headers["referer"])
+	if err == nil && isAllowedRedirect(req, loc) {
+		login.RawQuery = url.Values{"redirect": {loc.String()}}.Encode()
+	}
+	return login.String()
+}
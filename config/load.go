@@ -30,7 +30,9 @@ func Load(filename string) {
 	Controller = cfg.Controller
 	Service = cfg.Service
 	ExtAuthz = cfg.ExtAuthz
+	HTTP = cfg.HTTP
 	Sessions = cfg.Sessions
 	Replication = cfg.Replication
 	Telemetry = cfg.Telemetry
+	Admin = cfg.Admin
 }
@@ -13,9 +13,11 @@ func (c *config) normalize() {
 	c.Controller.normalize()
 	c.Service.normalize()
 	c.ExtAuthz.normalize()
+	c.HTTP.normalize()
 	c.Sessions.normalize()
 	c.Replication.normalize(c.Service.Address)
 	c.Telemetry.normalize()
+	c.Admin.normalize()
 }
 
 func (c *controller) normalize() {
@@ -67,6 +69,26 @@ func (ea *extAuthz) normalize() {
 	if ea.Timeout == 0 {
 		ea.Timeout = time.Second
 	}
+
+	switch ea.TransportAPIVersion {
+	case "":
+		ea.TransportAPIVersion = V2TransportAPI
+	case V2TransportAPI:
+	case V3TransportAPI:
+	default:
+		err := errors.New("invalid ext_authz transport API version")
+		log.Error(nil, err, "Failed loading config")
+		os.Exit(1)
+	}
+}
+
+func (h *httpServer) normalize() {
+	if h.Address == "" {
+		h.Address = ":8082"
+	}
+
+	h.PolicyHeader = strings.ToLower(h.PolicyHeader)
+	h.RouteHeader = strings.ToLower(h.RouteHeader)
 }
 
 func (s *sessions) normalize() {
@@ -77,6 +99,26 @@ func (s *sessions) normalize() {
 	if s.CleaningGracePeriod == 0 {
 		s.CleaningGracePeriod = time.Minute
 	}
+
+	if s.StateLifetime == 0 {
+		s.StateLifetime = 10 * time.Minute
+	}
+
+	if s.AccessTokenMargin == 0 {
+		s.AccessTokenMargin = 30 * time.Second
+	}
+
+	if s.TouchInterval == 0 {
+		s.TouchInterval = time.Minute
+	}
+
+	if s.TombstoneRetention == 0 {
+		s.TombstoneRetention = 10 * time.Minute
+	}
+
+	if s.RefreshLifetime == 0 {
+		s.RefreshLifetime = 24 * time.Hour
+	}
 }
 func (r *replication) normalize(bindAddr string) {
 	switch r.Mode {
@@ -111,3 +153,25 @@ func (t *telemetry) normalize() {
 		t.Address = ":8081"
 	}
 }
+
+func (a *admin) normalize() {
+	if a.Address == "" {
+		a.Address = ":8083"
+	}
+
+	if a.TokenFile != "" {
+		token, err := ioutil.ReadFile(a.TokenFile)
+		if err != nil {
+			err = errors.Wrap(err, "", "filename", a.TokenFile)
+			log.Error(nil, err, "Failed loading config")
+			os.Exit(1)
+		}
+
+		a.Token = strings.TrimSpace(string(token))
+		if a.Token == "" {
+			err = errors.New("empty admin token", "filename", a.TokenFile)
+			log.Error(nil, err, "Failed loading config")
+			os.Exit(1)
+		}
+	}
+}
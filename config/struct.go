@@ -8,9 +8,11 @@ type config struct {
 	Controller  controller  `yaml:"Controller"`
 	Service     service     `yaml:"Service"`
 	ExtAuthz    extAuthz    `yaml:"ExtAuthz"`
+	HTTP        httpServer  `yaml:"HTTP"`
 	Sessions    sessions    `yaml:"Sessions"`
 	Replication replication `yaml:"Replication"`
 	Telemetry   telemetry   `yaml:"Telemetry"`
+	Admin       admin       `yaml:"Admin"`
 }
 
 type controller struct {
@@ -29,15 +31,34 @@ type service struct {
 }
 
 type extAuthz struct {
-	ClusterName string        `yaml:"ClusterName"`
-	Timeout     time.Duration `yaml:"Timeout"`
+	ClusterName         string        `yaml:"ClusterName"`
+	Timeout             time.Duration `yaml:"Timeout"`
+	TransportAPIVersion string        `yaml:"TransportAPIVersion"`
+}
+
+type httpServer struct {
+	Address           string `yaml:"Address"`
+	ForwardAuth       bool   `yaml:"ForwardAuth"`
+	BackChannelLogout bool   `yaml:"BackChannelLogout"`
+	PolicyHeader      string `yaml:"PolicyHeader"`
+	RouteHeader       string `yaml:"RouteHeader"`
 }
 
 type sessions struct {
 	CleaningInterval    time.Duration `yaml:"CleaningInterval"`
 	CleaningGracePeriod time.Duration `yaml:"CleaningGracePeriod"`
+	StateLifetime       time.Duration `yaml:"StateLifetime"`
+	AccessTokenMargin   time.Duration `yaml:"AccessTokenMargin"`
+	TouchInterval       time.Duration `yaml:"TouchInterval"`
+	TombstoneRetention  time.Duration `yaml:"TombstoneRetention"`
+	RefreshLifetime     time.Duration `yaml:"RefreshLifetime"`
 }
 
+const (
+	V2TransportAPI = "V2"
+	V3TransportAPI = "V3"
+)
+
 const (
 	NoneMode   = "none"
 	StaticMode = "static"
@@ -61,3 +82,9 @@ type replicationPeerAddress struct {
 type telemetry struct {
 	Address string `yaml:"Address"`
 }
+
+type admin struct {
+	Address   string `yaml:"Address"`
+	TokenFile string `yaml:"TokenFile"`
+	Token     string `yaml:"-"`
+}
@@ -4,7 +4,9 @@ var (
 	Controller  controller
 	Service     service
 	ExtAuthz    extAuthz
+	HTTP        httpServer
 	Sessions    sessions
 	Replication replication
 	Telemetry   telemetry
+	Admin       admin
 )
@@ -0,0 +1,40 @@
+package accesspolicy
+
+import (
+	"github.com/KnowitSolutions/istio-oidc/api"
+	"k8s.io/apimachinery/pkg/runtime"
+	"strings"
+)
+
+const cookieNameIndex = "spec.oidc.cookie.name"
+
+func cookieName(obj runtime.Object) []string {
+	ap, ok := obj.(*api.AccessPolicy)
+	if !ok {
+		return nil
+	}
+
+	cookie := ap.Spec.OIDC.Cookie
+	cookie.Normalize()
+	return []string{cookie.Name}
+}
+
+func sharesHosts(a, b *api.AccessPolicy) bool {
+	if a.Namespace == b.Namespace && a.Spec.Gateway == b.Spec.Gateway {
+		return true
+	}
+
+	for _, vhost := range a.Status.VirtualHosts {
+		if contains(b.Status.VirtualHosts, vhost) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func cookiesCollide(a, b *api.AccessPolicyOIDCCookie) bool {
+	return a.Name == b.Name &&
+		strings.EqualFold(a.Domain, b.Domain) &&
+		(strings.HasPrefix(a.Path, b.Path) || strings.HasPrefix(b.Path, a.Path))
+}
@@ -0,0 +1,53 @@
+package accesspolicy
+
+import (
+	"github.com/KnowitSolutions/istio-oidc/api"
+	"reflect"
+	"testing"
+)
+
+func TestCookieName(t *testing.T) {
+	tests := []struct {
+		name   string
+		cookie api.AccessPolicyOIDCCookie
+		want   []string
+	}{
+		{"default", api.AccessPolicyOIDCCookie{}, []string{"bearer"}},
+		{"custom", api.AccessPolicyOIDCCookie{Name: "session"}, []string{"session"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ap := &api.AccessPolicy{}
+			ap.Spec.OIDC.Cookie = test.cookie
+			if got := cookieName(ap); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("cookieName() = %v, want %v", got, test.want)
+			}
+			if ap.Spec.OIDC.Cookie != test.cookie {
+				t.Errorf("cookieName() modified the AccessPolicy")
+			}
+		})
+	}
+}
+
+func TestCookiesCollide(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b api.AccessPolicyOIDCCookie
+		want bool
+	}{
+		{"same", api.AccessPolicyOIDCCookie{Name: "a", Path: "/"}, api.AccessPolicyOIDCCookie{Name: "a", Path: "/"}, true},
+		{"nested path", api.AccessPolicyOIDCCookie{Name: "a", Path: "/"}, api.AccessPolicyOIDCCookie{Name: "a", Path: "/x"}, true},
+		{"disjoint path", api.AccessPolicyOIDCCookie{Name: "a", Path: "/x"}, api.AccessPolicyOIDCCookie{Name: "a", Path: "/y"}, false},
+		{"other name", api.AccessPolicyOIDCCookie{Name: "a", Path: "/"}, api.AccessPolicyOIDCCookie{Name: "b", Path: "/"}, false},
+		{"domain case", api.AccessPolicyOIDCCookie{Name: "a", Domain: "A.com", Path: "/"}, api.AccessPolicyOIDCCookie{Name: "a", Domain: "a.com", Path: "/"}, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := cookiesCollide(&test.a, &test.b); got != test.want {
+				t.Errorf("cookiesCollide() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"crypto/rand"
 	"crypto/sha512"
+	"fmt"
 	"github.com/KnowitSolutions/istio-oidc/api"
 	"github.com/KnowitSolutions/istio-oidc/config"
 	"github.com/KnowitSolutions/istio-oidc/log"
@@ -86,6 +87,8 @@ func (r *leaderReconciler) reconcileSpec(ctx context.Context, ap *api.AccessPoli
 
 	ap.Normalize()
 
+	r.validateCookie(ctx, ap)
+
 	log.Info(ctx, nil, "Updating spec")
 	err := r.Update(ctx, ap)
 	if err != nil {
@@ -96,6 +99,29 @@ func (r *leaderReconciler) reconcileSpec(ctx context.Context, ap *api.AccessPoli
 	return nil
 }
 
+func (r *leaderReconciler) validateCookie(ctx context.Context, ap *api.AccessPolicy) {
+	all := api.AccessPolicyList{}
+	err := r.List(ctx, &all, client.MatchingFields{cookieNameIndex: ap.Spec.OIDC.Cookie.Name})
+	if err != nil {
+		log.Error(ctx, err, "Failed listing AccessPolicies")
+		r.Event(ap, "Warning", "CookieValidation", "Failed checking for cookie collisions")
+		return
+	}
+
+	for i := range all.Items {
+		other := &all.Items[i]
+		if other.Namespace == ap.Namespace && other.Name == ap.Name {
+			continue
+		}
+
+		other.Normalize()
+		if sharesHosts(ap, other) && cookiesCollide(&ap.Spec.OIDC.Cookie, &other.Spec.OIDC.Cookie) {
+			msg := fmt.Sprintf("Cookie collides with AccessPolicy %s/%s", other.Namespace, other.Name)
+			r.Event(ap, "Warning", "CookieCollision", msg)
+		}
+	}
+}
+
 func (r *leaderReconciler) reconcileStatus(ctx context.Context, ap *api.AccessPolicy) error {
 	gwName := ap.Spec.Gateway
 	gwKey := types.NamespacedName{Namespace: ap.Namespace, Name: gwName}
@@ -137,11 +163,21 @@ func (r *leaderReconciler) reconcileSecret(ctx context.Context, ap *api.AccessPo
 		r.Event(&secret, "Warning", "MissingClientID", "Missing client ID")
 	}
 
-	if len(secret.Data[ref.ClientSecretKey]) == 0 {
+	if ref.UsesClientSecret() && len(secret.Data[ref.ClientSecretKey]) == 0 {
 		r.Event(ap, "Warning", "MissingClientSecret", "Credentials secret is missing client secret")
 		r.Event(&secret, "Warning", "MissingClientSecret", "Missing client secret")
 	}
 
+	if ref.UsesPrivateKey() && len(secret.Data[ref.PrivateKeyKey]) == 0 {
+		r.Event(ap, "Warning", "MissingPrivateKey", "Credentials secret is missing private key")
+		r.Event(&secret, "Warning", "MissingPrivateKey", "Missing private key")
+	}
+
+	if ref.UsesCertificate() && len(secret.Data[ref.CertificateKey]) == 0 {
+		r.Event(ap, "Warning", "MissingCertificate", "Credentials secret is missing certificate")
+		r.Event(&secret, "Warning", "MissingCertificate", "Missing certificate")
+	}
+
 	if len(secret.Data[ref.TokenSecretKey]) != sha512.Size {
 		secret.Data[ref.TokenSecretKey] = make([]byte, sha512.Size)
 		_, err = rand.Read(secret.Data[ref.TokenSecretKey])
@@ -74,6 +74,14 @@ func secretIsRelated(obj *handler.MapObject, ap *api.AccessPolicy) bool {
 	return ap.Spec.OIDC.CredentialsSecret.Name == obj.Meta.GetName()
 }
 
+func newConfigMapMapper(mgr ctrl.Manager) handler.Mapper {
+	return &mapper{mgr.GetClient(), true, configMapIsRelated}
+}
+
+func configMapIsRelated(obj *handler.MapObject, ap *api.AccessPolicy) bool {
+	return ap.Spec.ErrorPages.ConfigMapName == obj.Meta.GetName()
+}
+
 func newEnvoyFilterMapper(mgr ctrl.Manager) handler.Mapper {
 	return &mapper{mgr.GetClient(), false, efIsRelated}
 }
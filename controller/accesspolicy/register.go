@@ -1,6 +1,7 @@
 package accesspolicy
 
 import (
+	"context"
 	"github.com/KnowitSolutions/istio-oidc/api"
 	"github.com/KnowitSolutions/istio-oidc/config"
 	"github.com/KnowitSolutions/istio-oidc/controller/predicate"
@@ -43,6 +44,11 @@ func Register(mgr ctrl.Manager, apStore accesspolicy.Store) error {
 }
 
 func registerLeader(mgr ctrl.Manager) error {
+	err := mgr.GetFieldIndexer().IndexField(context.Background(), &api.AccessPolicy{}, cookieNameIndex, cookieName)
+	if err != nil {
+		return err
+	}
+
 	r := leaderReconciler{
 		mgr.GetClient(),
 		mgr.GetEventRecorderFor("accesspolicy-leader"),
@@ -126,6 +132,14 @@ func registerWorker(mgr ctrl.Manager, apStore accesspolicy.Store) error {
 		return err
 	}
 
+	err = c.Watch(
+		&source.Kind{Type: &core.ConfigMap{}},
+		&handler.EnqueueRequestsFromMapFunc{ToRequests: newConfigMapMapper(mgr)},
+		&predicate.ResourceVersionChangedPredicate{})
+	if err != nil {
+		return err
+	}
+
 	return mgr.Add(workerController{c})
 }
 
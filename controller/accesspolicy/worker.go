@@ -87,6 +87,25 @@ func (r *workerReconciler) reconcileAuth(ctx context.Context, ap *api.AccessPoli
 		return nil
 	}
 	newAp.Oidc.Provider = newOp
+	if newAp.Oidc.ClientAuth.UsesMTLS() {
+		newAp.Oidc.Provider = newOp.WithMTLSAliases()
+	}
+
+	if ap.Spec.ErrorPages.ConfigMapName != "" {
+		pagesKey := types.NamespacedName{Namespace: ap.Namespace, Name: ap.Spec.ErrorPages.ConfigMapName}
+		pages := core.ConfigMap{}
+		err = r.Get(ctx, pagesKey, &pages)
+		if err != nil {
+			log.Error(ctx, err, "Failed getting error pages")
+			r.Event(ap, "Warning", "MissingErrorPages", "Failed getting error pages config map")
+		} else {
+			newAp.ErrorPages, err = accesspolicy.NewErrorPages(ap.Spec.ErrorPages, &pages)
+			if err != nil {
+				log.Error(ctx, err, "Invalid error pages")
+				r.Event(ap, "Warning", "InvalidErrorPages", "Invalid error pages")
+			}
+		}
+	}
 
 	log.Info(ctx, nil, "Storing OIDC settings")
 	r.AccessPolicies.Update(ctx, newAp)
@@ -3,6 +3,7 @@ package envoyfilter
 import (
 	"fmt"
 	"github.com/KnowitSolutions/istio-oidc/config"
+	"github.com/KnowitSolutions/istio-oidc/log/errors"
 	"github.com/KnowitSolutions/istio-oidc/state/accesspolicy"
 	istionetworkingapi "istio.io/api/networking/v1alpha3"
 	istionetworking "istio.io/client-go/pkg/apis/networking/v1alpha3"
@@ -13,7 +14,22 @@ import (
 var istioClusterName = regexp.MustCompile(`^.*?\|(\d+)\|(.*?)\|(.+?)$`)
 
 // TODO: Switch to new Istio ext_authz when it's ready: https://github.com/istio/istio/issues/27790
-func newEnvoyFilter(ef *istionetworking.EnvoyFilter, pols []*accesspolicy.AccessPolicy) {
+var extAuthzTypes = map[string]string{
+	config.V2TransportAPI: "type.googleapis.com/envoy.config.filter.http.ext_authz.v2.ExtAuthz",
+	config.V3TransportAPI: "type.googleapis.com/envoy.extensions.filters.http.ext_authz.v3.ExtAuthz",
+}
+
+var extAuthzPerRouteTypes = map[string]string{
+	config.V2TransportAPI: "type.googleapis.com/envoy.config.filter.http.ext_authz.v2.ExtAuthzPerRoute",
+	config.V3TransportAPI: "type.googleapis.com/envoy.extensions.filters.http.ext_authz.v3.ExtAuthzPerRoute",
+}
+
+func newEnvoyFilter(ef *istionetworking.EnvoyFilter, pols []*accesspolicy.AccessPolicy) error {
+	version, err := transportAPIVersion(pols)
+	if err != nil {
+		return err
+	}
+
 	count := 2
 	for _, pol := range pols {
 		count += len(pol.VirtualHosts) * len(pol.Routes)
@@ -39,14 +55,14 @@ func newEnvoyFilter(ef *istionetworking.EnvoyFilter, pols []*accesspolicy.Access
 	applyToHttpFilter(extAuthzFilter)
 	matchEnvoyRouter(extAuthzFilter)
 	insertBefore(extAuthzFilter)
-	extAuthz(extAuthzFilter, clusterName)
+	extAuthz(extAuthzFilter, version, clusterName)
 	ef.Spec.ConfigPatches = append(ef.Spec.ConfigPatches, extAuthzFilter)
 
 	extAuthzDisable := &istionetworkingapi.EnvoyFilter_EnvoyConfigObjectPatch{}
 	applyToVirtualHost(extAuthzDisable)
 	matchGateway(extAuthzDisable)
 	merge(extAuthzDisable)
-	extAuthzPerRoute(extAuthzDisable, "", "", nil)
+	extAuthzPerRoute(extAuthzDisable, version, "", "", nil)
 	ef.Spec.ConfigPatches = append(ef.Spec.ConfigPatches, extAuthzDisable)
 
 	for _, pol := range pols {
@@ -55,7 +71,14 @@ func newEnvoyFilter(ef *istionetworking.EnvoyFilter, pols []*accesspolicy.Access
 			applyToVirtualHost(patch)
 			matchVirtualHost(patch, vhost)
 			merge(patch)
-			extAuthzPerRoute(patch, pol.Name, "", &pol.Default)
+
+			// Path matched routes are resolved by the ext_authz server, so it
+			// has to be consulted even when the default route is disabled
+			def := pol.Default
+			if len(pol.Matched) > 0 {
+				def.EnableAuthz = true
+			}
+			extAuthzPerRoute(patch, version, pol.Name, "", &def)
 
 			ef.Spec.ConfigPatches = append(ef.Spec.ConfigPatches, patch)
 
@@ -64,12 +87,34 @@ func newEnvoyFilter(ef *istionetworking.EnvoyFilter, pols []*accesspolicy.Access
 				applyToHttpRoute(patch)
 				matchVirtualHostRoute(patch, vhost, route)
 				merge(patch)
-				extAuthzPerRoute(patch, pol.Name, route, &routeData)
+				extAuthzPerRoute(patch, version, pol.Name, route, &routeData)
 
 				ef.Spec.ConfigPatches = append(ef.Spec.ConfigPatches, patch)
 			}
 		}
 	}
+
+	return nil
+}
+
+func transportAPIVersion(pols []*accesspolicy.AccessPolicy) (string, error) {
+	var version, from string
+	for _, pol := range pols {
+		if pol.TransportAPIVersion == "" {
+			continue
+		} else if version == "" {
+			version, from = pol.TransportAPIVersion, pol.Name
+		} else if version != pol.TransportAPIVersion {
+			return "", errors.New("conflicting ext_authz transport API versions",
+				"AccessPolicy", from, "version", version,
+				"otherAccessPolicy", pol.Name, "otherVersion", pol.TransportAPIVersion)
+		}
+	}
+
+	if version == "" {
+		version = config.ExtAuthz.TransportAPIVersion
+	}
+	return version, nil
 }
 
 func parseIstioClusterName() (string, int, string, bool) {
@@ -90,24 +135,25 @@ func name(patch *istionetworkingapi.EnvoyFilter_EnvoyConfigObjectPatch, name str
 	})
 }
 
-func extAuthz(patch *istionetworkingapi.EnvoyFilter_EnvoyConfigObjectPatch, clusterName string) {
+func extAuthz(patch *istionetworkingapi.EnvoyFilter_EnvoyConfigObjectPatch, version, clusterName string) {
 	patch.Patch.Value = newStruct(map[string]interface{}{
 		"name": "envoy.filters.http.ext_authz",
 		"typed_config": map[string]interface{}{
-			"@type": "type.googleapis.com/envoy.config.filter.http.ext_authz.v2.ExtAuthz",
+			"@type": extAuthzTypes[version],
 			"grpc_service": map[string]interface{}{
 				"envoy_grpc": map[string]interface{}{
 					"cluster_name": clusterName,
 				},
 				"timeout": fmt.Sprintf("%.fs", config.ExtAuthz.Timeout.Seconds()),
 			},
+			"transport_api_version": version,
 		},
 	})
 }
 
-func extAuthzPerRoute(patch *istionetworkingapi.EnvoyFilter_EnvoyConfigObjectPatch, policy, route string, routeData *accesspolicy.Route) {
+func extAuthzPerRoute(patch *istionetworkingapi.EnvoyFilter_EnvoyConfigObjectPatch, version, policy, route string, routeData *accesspolicy.Route) {
 	cfg := map[string]interface{}{
-		"@type": "type.googleapis.com/envoy.config.filter.http.ext_authz.v2.ExtAuthzPerRoute",
+		"@type": extAuthzPerRouteTypes[version],
 	}
 
 	if routeData != nil && routeData.EnableAuthz {
@@ -0,0 +1,73 @@
+package envoyfilter
+
+import (
+	"github.com/KnowitSolutions/istio-oidc/config"
+	"github.com/KnowitSolutions/istio-oidc/state/accesspolicy"
+	ptypes "github.com/gogo/protobuf/types"
+	istionetworking "istio.io/client-go/pkg/apis/networking/v1alpha3"
+	"testing"
+)
+
+func field(s *ptypes.Struct, path ...string) string {
+	for _, p := range path[:len(path)-1] {
+		s = s.Fields[p].GetStructValue()
+	}
+	return s.Fields[path[len(path)-1]].GetStringValue()
+}
+
+func TestTransportAPIVersion(t *testing.T) {
+	defer func(v string) { config.ExtAuthz.TransportAPIVersion = v }(config.ExtAuthz.TransportAPIVersion)
+	config.ExtAuthz.TransportAPIVersion = config.V2TransportAPI
+
+	tests := []struct {
+		name     string
+		versions []string
+		want     string
+		err      bool
+	}{
+		{"default", []string{""}, config.V2TransportAPI, false},
+		{"v2", []string{config.V2TransportAPI}, config.V2TransportAPI, false},
+		{"v3", []string{config.V3TransportAPI, ""}, config.V3TransportAPI, false},
+		{"agreeing", []string{config.V3TransportAPI, config.V3TransportAPI}, config.V3TransportAPI, false},
+		{"conflicting", []string{config.V2TransportAPI, config.V3TransportAPI}, "", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			pols := make([]*accesspolicy.AccessPolicy, len(test.versions))
+			for i, v := range test.versions {
+				pols[i] = &accesspolicy.AccessPolicy{
+					Name:                "default/test",
+					VirtualHosts:        []string{"app.example.com:443"},
+					TransportAPIVersion: v,
+				}
+			}
+
+			ef := &istionetworking.EnvoyFilter{}
+			err := newEnvoyFilter(ef, pols)
+			if test.err {
+				if err == nil {
+					t.Fatal("newEnvoyFilter() succeeded, want error")
+				}
+				return
+			} else if err != nil {
+				t.Fatal(err)
+			}
+
+			filter := ef.Spec.ConfigPatches[0].Patch.Value
+			if got := field(filter, "typed_config", "@type"); got != extAuthzTypes[test.want] {
+				t.Errorf("ExtAuthz type = %q, want %q", got, extAuthzTypes[test.want])
+			}
+			if got := field(filter, "typed_config", "transport_api_version"); got != test.want {
+				t.Errorf("transport_api_version = %q, want %q", got, test.want)
+			}
+
+			for _, patch := range ef.Spec.ConfigPatches[1:] {
+				got := field(patch.Patch.Value, "typed_per_filter_config", "envoy.filters.http.ext_authz", "@type")
+				if got != extAuthzPerRouteTypes[test.want] {
+					t.Errorf("ExtAuthzPerRoute type = %q, want %q", got, extAuthzPerRouteTypes[test.want])
+				}
+			}
+		})
+	}
+}
@@ -56,7 +56,11 @@ func (r *reconciler) Reconcile(req reconcile.Request) (reconcile.Result, error)
 		log.Info(ctx, vals, "Including AccessPolicy in EnvoyFilter")
 	}
 
-	newEnvoyFilter(&ef, aps)
+	err = newEnvoyFilter(&ef, aps)
+	if err != nil {
+		return reconcile.Result{}, errors.Wrap(err, "failed generating EnvoyFilter")
+	}
+
 	log.Info(ctx, nil, "Updating resource")
 	err = r.Update(ctx, &ef)
 	if err != nil {
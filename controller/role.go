@@ -10,6 +10,7 @@ package controller
 // +kubebuilder:rbac:groups=networking.istio.io,resources=gateways,verbs=get;list;watch
 // +kubebuilder:rbac:groups=networking.istio.io,resources=envoyfilters,verbs=create;get;list;update;watch
 // +kubebuilder:rbac:groups="",resources=secrets,verbs=create;get;list;update;watch
+// +kubebuilder:rbac:groups="",resources=configmaps,verbs=get;list;watch
 
 // Events
 // +kubebuilder:rbac:groups="",resources=events,verbs=create;patch
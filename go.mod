@@ -4,14 +4,13 @@ go 1.14
 
 require (
 	github.com/apex/log v1.9.0
-	github.com/cncf/udpa/go v0.0.0-20200909154343-1f710aca26a9 // indirect
-	github.com/envoyproxy/go-control-plane v0.9.6
+	github.com/envoyproxy/go-control-plane v0.9.9
 	github.com/envoyproxy/protoc-gen-validate v0.4.1 // indirect
 	github.com/fatih/color v1.9.0 // indirect
 	github.com/go-logr/logr v0.2.1
 	github.com/gobuffalo/flect v0.2.2 // indirect
 	github.com/gogo/protobuf v1.3.1
-	github.com/golang/protobuf v1.4.2
+	github.com/golang/protobuf v1.4.3
 	github.com/google/go-cmp v0.5.2 // indirect
 	github.com/google/gofuzz v1.2.0 // indirect
 	github.com/google/uuid v1.1.2 // indirect
@@ -29,7 +28,7 @@ require (
 	golang.org/x/tools v0.0.0-20200929223013-bf155c11ec6f // indirect
 	gomodules.xyz/jsonpatch/v2 v2.1.0 // indirect
 	google.golang.org/genproto v0.0.0-20200929141702-51c3e5b607fe
-	google.golang.org/grpc v1.32.0
+	google.golang.org/grpc v1.36.0
 	google.golang.org/grpc/cmd/protoc-gen-go-grpc v0.0.0-20200930005306-bb64fee312b4
 	google.golang.org/protobuf v1.25.0
 	gopkg.in/square/go-jose.v2 v2.5.1
@@ -1,6 +1,7 @@
 package errors
 
 import (
+	"errors"
 	"github.com/apex/log"
 )
 
@@ -71,3 +72,11 @@ func (err *annotated) Fields() log.Fields {
 
 	return fields
 }
+
+func (err *annotated) Unwrap() error {
+	return err.cause
+}
+
+func Is(err, target error) bool {
+	return errors.Is(err, target)
+}
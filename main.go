@@ -2,6 +2,7 @@ package main
 
 import (
 	"flag"
+	"github.com/KnowitSolutions/istio-oidc/admin"
 	"github.com/KnowitSolutions/istio-oidc/api"
 	"github.com/KnowitSolutions/istio-oidc/auth"
 	"github.com/KnowitSolutions/istio-oidc/config"
@@ -11,8 +12,10 @@ import (
 	"github.com/KnowitSolutions/istio-oidc/replication"
 	"github.com/KnowitSolutions/istio-oidc/state/accesspolicy"
 	"github.com/KnowitSolutions/istio-oidc/state/session"
+	"github.com/KnowitSolutions/istio-oidc/state/usedstate"
 	"github.com/KnowitSolutions/istio-oidc/telemetry"
 	authv2 "github.com/envoyproxy/go-control-plane/envoy/service/auth/v2"
+	authv3 "github.com/envoyproxy/go-control-plane/envoy/service/auth/v3"
 	"google.golang.org/grpc"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/klog/v2"
@@ -44,14 +47,21 @@ func main() {
 		os.Exit(1)
 	}
 
-	self := replication.NewSelf(id, sessStore)
+	stateStore := usedstate.NewUsedStateStore()
+	self := replication.NewSelf(id, sessStore, stateStore)
 	peers := replication.NewPeers()
 
 	init := make(chan struct{})
 
 	go startCtrl(apStore)
-	go startGrpc(apStore, sessStore, self, peers, init)
+	go startGrpc(apStore, sessStore, stateStore, self, peers, init)
 	go startTelemetry(init, apStore, sessStore)
+	if config.Admin.Token != "" {
+		go startAdmin(sessStore, self, peers)
+	}
+	if config.HTTP.ForwardAuth || config.HTTP.BackChannelLogout {
+		go startHTTP(apStore, sessStore, stateStore, self, peers)
+	}
 	select {}
 }
 
@@ -98,6 +108,7 @@ func startCtrl(
 func startGrpc(
 	apStore accesspolicy.Store,
 	sessStore session.Store,
+	stateStore usedstate.Store,
 	self *replication.Self,
 	peers *replication.Peers,
 	init chan<- struct{},
@@ -110,7 +121,7 @@ func startGrpc(
 	}
 
 	srv := grpc.NewServer()
-	startExtAuthz(srv, apStore, sessStore, self, peers)
+	startExtAuthz(srv, apStore, sessStore, stateStore, self, peers)
 	startReplication(srv, self, peers, init)
 
 	err = srv.Serve(lis)
@@ -124,15 +135,50 @@ func startExtAuthz(
 	srv *grpc.Server,
 	apStore accesspolicy.Store,
 	sessStore session.Store,
+	stateStore usedstate.Store,
 	self *replication.Self,
 	peers *replication.Peers,
 ) {
 	extAuth := auth.Server{
 		AccessPolicies: apStore,
 		Sessions:       sessStore,
+		UsedStates:     stateStore,
 		Client:         replication.Client{Self: self, Peers: peers},
 	}
 	authv2.RegisterAuthorizationServer(srv, extAuth.V2())
+	authv3.RegisterAuthorizationServer(srv, extAuth.V3())
+}
+
+func startHTTP(
+	apStore accesspolicy.Store,
+	sessStore session.Store,
+	stateStore usedstate.Store,
+	self *replication.Self,
+	peers *replication.Peers,
+) {
+	extAuth := auth.Server{
+		AccessPolicies: apStore,
+		Sessions:       sessStore,
+		UsedStates:     stateStore,
+		Client:         replication.Client{Self: self, Peers: peers},
+	}
+
+	mux := http.NewServeMux()
+	if config.HTTP.ForwardAuth {
+		mux.Handle(auth.ForwardAuthPath, extAuth.HTTP())
+		mux.Handle(auth.AuthRequestPath, extAuth.HTTP())
+	}
+	if config.HTTP.BackChannelLogout {
+		mux.Handle(auth.BackChannelLogoutPath, extAuth.HTTP())
+	}
+	srv := http.Server{Addr: config.HTTP.Address, Handler: mux}
+
+	err := srv.ListenAndServe()
+	if err != nil {
+		err = errors.Wrap(err, "", "address", config.HTTP.Address)
+		log.Error(nil, err, "Unable to start HTTP server")
+		os.Exit(1)
+	}
 }
 
 func startReplication(
@@ -166,3 +212,21 @@ func startTelemetry(
 		os.Exit(1)
 	}
 }
+
+func startAdmin(
+	sessStore session.Store,
+	self *replication.Self,
+	peers *replication.Peers,
+) {
+	mux := http.NewServeMux()
+	srv := http.Server{Addr: config.Admin.Address, Handler: admin.Authenticate(config.Admin.Token, mux)}
+
+	admin.RegisterRevocation(mux, sessStore, replication.Client{Self: self, Peers: peers})
+
+	err := srv.ListenAndServe()
+	if err != nil {
+		err = errors.Wrap(err, "", "address", config.Admin.Address)
+		log.Error(nil, err, "Unable to start HTTP server")
+		os.Exit(1)
+	}
+}
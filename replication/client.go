@@ -3,6 +3,7 @@ package replication
 import (
 	"context"
 	"github.com/KnowitSolutions/istio-oidc/state/session"
+	"time"
 )
 
 type Client struct {
@@ -18,4 +19,21 @@ func (c Client) SetSession(sess session.Stamped) {
 	for _, conn := range conns {
 		go conn.setSession(ctx, c.Self, sess)
 	}
-}
\ No newline at end of file
+}
+
+func (c Client) TouchSession(id string, lastSeen time.Time) {
+	ctx := context.Background()
+
+	conns := c.Peers.getConnections()
+	for _, conn := range conns {
+		go conn.touchSession(ctx, c.Self, id, lastSeen)
+	}
+}
+func (c Client) UseState(id string, expiry time.Time) {
+	ctx := context.Background()
+
+	conns := c.Peers.getConnections()
+	for _, conn := range conns {
+		go conn.useState(ctx, c.Self, id, expiry)
+	}
+}
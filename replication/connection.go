@@ -10,10 +10,12 @@ import (
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/connectivity"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
 	"io"
 	"os"
 	"strings"
 	"sync"
+	"time"
 )
 
 type connection struct {
@@ -103,6 +105,10 @@ func (c *connection) update(ctx context.Context, self *Self, latest []*api.Stamp
 		c.live = true
 	}
 
+	if c.live {
+		c.live = c.streamUsedStates(ctx, self)
+	}
+
 	c.cond.Broadcast()
 }
 
@@ -111,6 +117,7 @@ func (c *connection) setSession(ctx context.Context, self *Self, sess session.St
 		PeerId:  self.id,
 		Session: sessionToProto(sess.Session),
 		Stamp:   stampToProto(sess.Stamp),
+		Deleted: sess.Deleted,
 	}
 
 	vals := log.MakeValues("session", hex.EncodeToString(req.Session.Id))
@@ -124,6 +131,63 @@ func (c *connection) setSession(ctx context.Context, self *Self, sess session.St
 	}
 }
 
+func (c *connection) touchSession(ctx context.Context, self *Self, id string, lastSeen time.Time) {
+	req := api.TouchSessionRequest{
+		PeerId:   self.id,
+		Id:       []byte(id),
+		LastSeen: timestamppb.New(lastSeen),
+	}
+
+	client := api.NewReplicationClient(c.conn)
+	_, err := client.TouchSession(ctx, &req)
+	if err != nil {
+		log.Error(ctx, err, "Failed sending session activity to peer")
+		go c.reestablish(ctx, self, err)
+	}
+}
+
+func (c *connection) useState(ctx context.Context, self *Self, id string, expiry time.Time) {
+	req := api.UseStateRequest{
+		PeerId: self.id,
+		Id:     []byte(id),
+		Expiry: timestamppb.New(expiry),
+	}
+
+	client := api.NewReplicationClient(c.conn)
+	_, err := client.UseState(ctx, &req)
+	if err != nil {
+		log.Error(ctx, err, "Failed sending used login state to peer")
+		go c.reestablish(ctx, self, err)
+	}
+}
+
+func (c *connection) streamUsedStates(ctx context.Context, self *Self) bool {
+	req := api.StreamUsedStatesRequest{PeerId: self.id}
+
+	client := api.NewReplicationClient(c.conn)
+	stream, err := client.StreamUsedStates(ctx, &req)
+	if err != nil {
+		log.Error(ctx, err, "Failed streaming used login states from peer")
+		go c.reestablish(ctx, self, err)
+		return false
+	}
+
+	for {
+		res, err := stream.Recv()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			log.Error(ctx, err, "Failed receiving used login state from peer")
+			go c.reestablish(ctx, self, err)
+			return false
+		}
+
+		self.stateStore.Use(string(res.Id), timeFromProto(res.Expiry))
+	}
+
+	return true
+}
+
 func (c *connection) streamSessions(ctx context.Context, self *Self) bool {
 	log.Info(ctx, nil, "Streaming new sessions from peer")
 
@@ -156,6 +220,7 @@ func (c *connection) streamSessions(ctx context.Context, self *Self) bool {
 		sess := session.Stamped{
 			Session: sessionFromProto(res.Session),
 			Stamp:   stampFromProto(res.Stamp),
+			Deleted: res.Deleted,
 		}
 		_, err = self.sessStore.Set(sess)
 		if err != nil {
@@ -4,24 +4,48 @@ import (
 	"github.com/KnowitSolutions/istio-oidc/api"
 	"github.com/KnowitSolutions/istio-oidc/state/session"
 	"google.golang.org/protobuf/types/known/timestamppb"
+	"time"
 )
 
 func sessionToProto(obj session.Session) *api.Session {
 	return &api.Session{
-		Id:           []byte(obj.Id),
-		RefreshToken: obj.RefreshToken,
-		Expiry:       timestamppb.New(obj.Expiry),
+		Id:                []byte(obj.Id),
+		Issuer:            obj.Issuer,
+		Subject:           obj.Subject,
+		SessionId:         obj.SessionId,
+		RefreshToken:      obj.RefreshToken,
+		IdToken:           obj.IdToken,
+		Expiry:            timestamppb.New(obj.Expiry),
+		AccessToken:       obj.AccessToken,
+		AccessTokenExpiry: timestamppb.New(obj.AccessTokenExpiry),
+		Created:           timestamppb.New(obj.Created),
+		LastSeen:          timestamppb.New(obj.LastSeen),
 	}
 }
 
 func sessionFromProto(proto *api.Session) session.Session {
 	return session.Session{
-		Id:           string(proto.Id),
-		RefreshToken: proto.RefreshToken,
-		Expiry:       proto.Expiry.AsTime(),
+		Id:                string(proto.Id),
+		Issuer:            proto.Issuer,
+		Subject:           proto.Subject,
+		SessionId:         proto.SessionId,
+		RefreshToken:      proto.RefreshToken,
+		IdToken:           proto.IdToken,
+		Expiry:            proto.Expiry.AsTime(),
+		AccessToken:       proto.AccessToken,
+		AccessTokenExpiry: timeFromProto(proto.AccessTokenExpiry),
+		Created:           timeFromProto(proto.Created),
+		LastSeen:          timeFromProto(proto.LastSeen),
 	}
 }
 
+func timeFromProto(proto *timestamppb.Timestamp) time.Time {
+	if proto == nil {
+		return time.Time{}
+	}
+	return proto.AsTime()
+}
+
 func stampToProto(obj session.Stamp) *api.Stamp {
 	return &api.Stamp{
 		PeerId: obj.PeerId,
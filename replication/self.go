@@ -3,6 +3,7 @@ package replication
 import (
 	"github.com/KnowitSolutions/istio-oidc/config"
 	"github.com/KnowitSolutions/istio-oidc/state/session"
+	"github.com/KnowitSolutions/istio-oidc/state/usedstate"
 	"sync"
 )
 
@@ -13,15 +14,17 @@ type Self struct {
 	latest map[string]uint64
 	mu     sync.RWMutex
 
-	sessStore session.Store
+	sessStore  session.Store
+	stateStore usedstate.Store
 }
 
-func NewSelf(id string, sessStore session.Store) *Self {
+func NewSelf(id string, sessStore session.Store, stateStore usedstate.Store) *Self {
 	return &Self{
-		id:        id,
-		ep:        config.Replication.AdvertiseAddress,
-		latest:    map[string]uint64{},
-		sessStore: sessStore,
+		id:         id,
+		ep:         config.Replication.AdvertiseAddress,
+		latest:     map[string]uint64{},
+		sessStore:  sessStore,
+		stateStore: stateStore,
 	}
 }
 
@@ -9,6 +9,7 @@ import (
 	"google.golang.org/grpc/codes"
 	grpcpeer "google.golang.org/grpc/peer"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 type Server struct {
@@ -51,7 +52,7 @@ func (s Server) SetSession(ctx context.Context, req *api.SetSessionRequest) (*ap
 	vals := log.MakeValues("session", hex.EncodeToString(req.Session.Id))
 	log.Info(ctx, vals, "Received session from peer")
 
-	_, err := s.Self.sessStore.Set(session.Stamped{Session: sess, Stamp: stamp})
+	_, err := s.Self.sessStore.Set(session.Stamped{Session: sess, Stamp: stamp, Deleted: req.Deleted})
 	if err == nil {
 		s.Self.update(stamp.PeerId, stamp.Serial)
 		return &api.SetSessionResponse{}, nil
@@ -63,6 +64,37 @@ func (s Server) SetSession(ctx context.Context, req *api.SetSessionRequest) (*ap
 
 }
 
+func (s Server) TouchSession(ctx context.Context, req *api.TouchSessionRequest) (*api.TouchSessionResponse, error) {
+	s.Self.sessStore.Touch(string(req.Id), timeFromProto(req.LastSeen))
+	return &api.TouchSessionResponse{}, nil
+}
+
+func (s Server) UseState(ctx context.Context, req *api.UseStateRequest) (*api.UseStateResponse, error) {
+	s.Self.stateStore.Use(string(req.Id), timeFromProto(req.Expiry))
+	return &api.UseStateResponse{}, nil
+}
+
+func (s Server) StreamUsedStates(req *api.StreamUsedStatesRequest, stream api.Replication_StreamUsedStatesServer) error {
+	ctx := addressCtx(stream.Context())
+	ctx = log.WithValues(ctx, "peer", req.PeerId)
+
+	log.Info(ctx, nil, "Streaming used login states to peer")
+	for id, expiry := range s.Self.stateStore.Stream() {
+		res := &api.StreamUsedStatesResponse{
+			Id:     []byte(id),
+			Expiry: timestamppb.New(expiry),
+		}
+
+		err := stream.Send(res)
+		if err != nil {
+			log.Error(ctx, err, "Failed sending used login state to peer")
+			return err
+		}
+	}
+
+	return nil
+}
+
 func (s Server) StreamSessions(req *api.StreamSessionsRequest, stream api.Replication_StreamSessionsServer) error {
 	ctx := addressCtx(stream.Context())
 	ctx = log.WithValues(ctx, "peer", req.PeerId)
@@ -78,6 +110,7 @@ func (s Server) StreamSessions(req *api.StreamSessionsRequest, stream api.Replic
 		req := &api.StreamSessionsResponse{
 			Session: sess,
 			Stamp:   stamp,
+			Deleted: e.Deleted,
 		}
 
 		vals := log.MakeValues("session", hex.EncodeToString(req.Session.Id))
@@ -0,0 +1,225 @@
+package accesspolicy
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"github.com/KnowitSolutions/istio-oidc/api"
+	"github.com/KnowitSolutions/istio-oidc/log/errors"
+	"github.com/KnowitSolutions/istio-oidc/state/openidprovider"
+	"golang.org/x/oauth2"
+	"gopkg.in/square/go-jose.v2"
+	"gopkg.in/square/go-jose.v2/jwt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	clientAssertionType     = "urn:ietf:params:oauth:client-assertion-type:jwt-bearer"
+	clientAssertionLifetime = time.Minute
+)
+
+type ClientAuth struct {
+	Method string
+	client *http.Client
+}
+
+type clientAuthTransport struct {
+	base     http.RoundTripper
+	clientId string
+	signer   jose.Signer
+}
+
+func newClientAuth(method, clientId, clientSecret string, key, keyId, cert []byte) (ClientAuth, error) {
+	auth := ClientAuth{Method: method}
+	switch method {
+	case api.ClientSecretJWT:
+		sk := jose.SigningKey{Algorithm: jose.HS256, Key: []byte(clientSecret)}
+		signer, err := jose.NewSigner(sk, nil)
+		if err != nil {
+			return ClientAuth{}, errors.Wrap(err, "failed creating client assertion signer")
+		}
+		auth.client = &http.Client{Transport: &clientAuthTransport{http.DefaultTransport, clientId, signer}}
+
+	case api.PrivateKeyJWT:
+		pk, err := parsePrivateKey(key)
+		if err != nil {
+			return ClientAuth{}, err
+		}
+
+		alg, err := signingAlgorithm(pk)
+		if err != nil {
+			return ClientAuth{}, err
+		}
+
+		opts := &jose.SignerOptions{}
+		if len(keyId) > 0 {
+			opts = opts.WithHeader("kid", string(keyId))
+		}
+		sk := jose.SigningKey{Algorithm: alg, Key: pk}
+		signer, err := jose.NewSigner(sk, opts)
+		if err != nil {
+			return ClientAuth{}, errors.Wrap(err, "failed creating client assertion signer")
+		}
+		auth.client = &http.Client{Transport: &clientAuthTransport{http.DefaultTransport, clientId, signer}}
+
+	case api.TLSClientAuth, api.SelfSignedTLSClientAuth:
+		pair, err := tls.X509KeyPair(cert, key)
+		if err != nil {
+			return ClientAuth{}, errors.Wrap(err, "failed parsing client certificate")
+		}
+
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = &tls.Config{Certificates: []tls.Certificate{pair}}
+		auth.client = &http.Client{Transport: transport}
+	}
+
+	return auth, nil
+}
+
+func signingAlgorithm(key crypto.Signer) (jose.SignatureAlgorithm, error) {
+	switch key := key.(type) {
+	case *rsa.PrivateKey:
+		return jose.RS256, nil
+	case *ecdsa.PrivateKey:
+		switch key.Curve {
+		case elliptic.P256():
+			return jose.ES256, nil
+		case elliptic.P384():
+			return jose.ES384, nil
+		case elliptic.P521():
+			return jose.ES512, nil
+		default:
+			return "", errors.New("unsupported elliptic curve", "curve", key.Curve.Params().Name)
+		}
+	default:
+		return "", errors.New("unsupported private key type")
+	}
+}
+
+func parsePrivateKey(data []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("private key is not PEM encoded")
+	}
+
+	if key, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+		signer, ok := key.(crypto.Signer)
+		if !ok {
+			return nil, errors.New("unsupported private key type")
+		}
+		return signer, nil
+	} else if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	} else if key, err := x509.ParseECPrivateKey(block.Bytes); err == nil {
+		return key, nil
+	} else {
+		return nil, errors.New("failed parsing private key")
+	}
+}
+
+func (ca ClientAuth) authStyle() oauth2.AuthStyle {
+	switch ca.Method {
+	case "":
+		return oauth2.AuthStyleAutoDetect
+	case api.ClientSecretBasic:
+		return oauth2.AuthStyleInHeader
+	default:
+		return oauth2.AuthStyleInParams
+	}
+}
+
+func (ca ClientAuth) UsesMTLS() bool {
+	return ca.Method == api.TLSClientAuth || ca.Method == api.SelfSignedTLSClientAuth
+}
+
+func (ca ClientAuth) sendsSecret() bool {
+	return ca.Method == "" || ca.Method == api.ClientSecretBasic || ca.Method == api.ClientSecretPost
+}
+
+func (oidc Oidc) Credentials() openidprovider.Credentials {
+	creds := openidprovider.Credentials{ClientId: oidc.ClientId}
+	if oidc.ClientAuth.sendsSecret() {
+		creds.ClientSecret = oidc.ClientSecret
+	}
+	return creds
+}
+
+func (oidc Oidc) TokenContext(ctx context.Context) context.Context {
+	if oidc.ClientAuth.client == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, oauth2.HTTPClient, oidc.ClientAuth.client)
+}
+
+func (t *clientAuthTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodPost || req.Body == nil {
+		return t.base.RoundTrip(req)
+	}
+
+	body, err := ioutil.ReadAll(req.Body)
+	_ = req.Body.Close()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed reading token request")
+	}
+
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed parsing token request")
+	}
+
+	assertion, err := t.assertion(req.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	form.Set("client_id", t.clientId)
+	form.Set("client_assertion_type", clientAssertionType)
+	form.Set("client_assertion", assertion)
+	encoded := form.Encode()
+
+	clone := req.Clone(req.Context())
+	clone.Body = ioutil.NopCloser(strings.NewReader(encoded))
+	clone.ContentLength = int64(len(encoded))
+	clone.GetBody = func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(strings.NewReader(encoded)), nil
+	}
+	return t.base.RoundTrip(clone)
+}
+
+func (t *clientAuthTransport) assertion(endpoint *url.URL) (string, error) {
+	id := make([]byte, 16)
+	_, err := rand.Read(id)
+	if err != nil {
+		return "", errors.Wrap(err, "failed generating client assertion ID")
+	}
+
+	aud := *endpoint
+	aud.RawQuery = ""
+	now := time.Now()
+	claims := jwt.Claims{
+		Issuer:   t.clientId,
+		Subject:  t.clientId,
+		Audience: jwt.Audience{aud.String()},
+		ID:       base64.RawURLEncoding.EncodeToString(id),
+		IssuedAt: jwt.NewNumericDate(now),
+		Expiry:   jwt.NewNumericDate(now.Add(clientAssertionLifetime)),
+	}
+
+	tok, err := jwt.Signed(t.signer).Claims(claims).CompactSerialize()
+	if err != nil {
+		return "", errors.Wrap(err, "failed signing client assertion")
+	}
+	return tok, nil
+}
@@ -0,0 +1,133 @@
+package accesspolicy
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"github.com/KnowitSolutions/istio-oidc/api"
+	"gopkg.in/square/go-jose.v2"
+	"gopkg.in/square/go-jose.v2/jwt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func pemKey(t *testing.T, key crypto.Signer) []byte {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+}
+
+func ecKey(t *testing.T, curve elliptic.Curve) crypto.Signer {
+	key, err := ecdsa.GenerateKey(curve, rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestClientAssertion(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		key    crypto.Signer
+		alg    jose.SignatureAlgorithm
+		err    bool
+	}{
+		{name: "client secret", method: api.ClientSecretJWT, alg: jose.HS256},
+		{name: "rsa", method: api.PrivateKeyJWT, key: rsaKey, alg: jose.RS256},
+		{name: "p256", method: api.PrivateKeyJWT, key: ecKey(t, elliptic.P256()), alg: jose.ES256},
+		{name: "p384", method: api.PrivateKeyJWT, key: ecKey(t, elliptic.P384()), alg: jose.ES384},
+		{name: "p521", method: api.PrivateKeyJWT, key: ecKey(t, elliptic.P521()), alg: jose.ES512},
+		{name: "p224", method: api.PrivateKeyJWT, key: ecKey(t, elliptic.P224()), err: true},
+		{name: "not pem", method: api.PrivateKeyJWT, err: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var form url.Values
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				_ = r.ParseForm()
+				form = r.PostForm
+			}))
+			defer srv.Close()
+
+			var key []byte
+			if test.key != nil {
+				key = pemKey(t, test.key)
+			}
+
+			auth, err := newClientAuth(test.method, "client", strings.Repeat("s", 32), key, []byte("kid"), nil)
+			if test.err {
+				if err == nil {
+					t.Fatal("newClientAuth() succeeded, want error")
+				}
+				return
+			} else if err != nil {
+				t.Fatal(err)
+			}
+
+			body := strings.NewReader(url.Values{"grant_type": {"authorization_code"}}.Encode())
+			res, err := auth.client.Post(srv.URL+"/token?x=1", "application/x-www-form-urlencoded", body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_ = res.Body.Close()
+
+			if form.Get("grant_type") != "authorization_code" {
+				t.Errorf("grant_type = %q, want original form preserved", form.Get("grant_type"))
+			}
+			if form.Get("client_id") != "client" {
+				t.Errorf("client_id = %q, want %q", form.Get("client_id"), "client")
+			}
+			if form.Get("client_assertion_type") != clientAssertionType {
+				t.Errorf("client_assertion_type = %q, want %q", form.Get("client_assertion_type"), clientAssertionType)
+			}
+
+			parsed, err := jwt.ParseSigned(form.Get("client_assertion"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if alg := parsed.Headers[0].Algorithm; alg != string(test.alg) {
+				t.Errorf("alg = %q, want %q", alg, test.alg)
+			}
+
+			var verify interface{} = []byte(strings.Repeat("s", 32))
+			if test.key != nil {
+				verify = test.key.Public()
+				if kid := parsed.Headers[0].KeyID; kid != "kid" {
+					t.Errorf("kid = %q, want %q", kid, "kid")
+				}
+			}
+
+			claims := jwt.Claims{}
+			err = parsed.Claims(verify, &claims)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			exp := jwt.Expected{Issuer: "client", Subject: "client", Audience: jwt.Audience{srv.URL + "/token"}, Time: time.Now()}
+			err = claims.Validate(exp)
+			if err != nil {
+				t.Error(err)
+			}
+			if claims.ID == "" {
+				t.Error("missing jti")
+			}
+		})
+	}
+}
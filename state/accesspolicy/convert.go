@@ -5,7 +5,11 @@ import (
 	"github.com/KnowitSolutions/istio-oidc/api"
 	"github.com/KnowitSolutions/istio-oidc/log/errors"
 	core "k8s.io/api/core/v1"
+	"net/http"
 	"net/url"
+	"regexp"
+	"strings"
+	"text/template"
 )
 
 type accessPolicySpecStatus struct {
@@ -13,13 +17,18 @@ type accessPolicySpecStatus struct {
 	status api.AccessPolicyStatus
 }
 type accessPolicyOIDC api.AccessPolicyOIDC
+type accessPolicyOIDCCookie api.AccessPolicyOIDCCookie
 type accessPolicyRoute api.AccessPolicyRoute
+type accessPolicyRouteMatch api.AccessPolicyRouteMatch
+type accessPolicyRouteUnauthenticated api.AccessPolicyRouteUnauthenticated
 type accessPolicyRoles []string
 type accessPolicyRouteHeaders []api.AccessPolicyRouteHeader
 type accessPolicyRouteHeader api.AccessPolicyRouteHeader
+type accessPolicyRoleExpression api.AccessPolicyRoleExpression
 
 func New(ap *api.AccessPolicy, secret *core.Secret) (*AccessPolicy, error) {
-	spec := accessPolicySpecStatus{ap.Spec, ap.Status}
+	spec := accessPolicySpecStatus{*ap.Spec.DeepCopy(), ap.Status}
+	spec.spec.Normalize()
 	name := fmt.Sprintf("%s/%s", ap.Namespace, ap.Name)
 	return spec.convert(name, secret)
 }
@@ -27,14 +36,28 @@ func New(ap *api.AccessPolicy, secret *core.Secret) (*AccessPolicy, error) {
 func (ap *accessPolicySpecStatus) convert(name string, secret *core.Secret) (*AccessPolicy, error) {
 	oidc := accessPolicyOIDC(ap.spec.OIDC)
 
-	defRoute := Route{EnableAuthz: true}
+	defSpec := accessPolicyRoute{}
+	defSpec.Unauthenticated.Normalize()
+	defRoute, err := defSpec.convert()
+	if err != nil {
+		return nil, err
+	}
+
 	routes := make(Routes, len(ap.spec.Routes))
+	matched := make([]Route, 0)
 	for _, route := range ap.spec.Routes {
 		route := accessPolicyRoute(route)
-		if route.Name == "" {
-			defRoute = route.convert()
+		conv, err := route.convert()
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid route", "route", route.Name)
+		}
+
+		if conv.Match != nil {
+			matched = append(matched, conv)
+		} else if route.Name == "" {
+			defRoute = conv
 		} else {
-			routes[route.Name] = route.convert()
+			routes[route.Name] = conv
 		}
 	}
 
@@ -48,50 +71,203 @@ func (ap *accessPolicySpecStatus) convert(name string, secret *core.Secret) (*Ac
 		Oidc:         oidcCfg,
 		Default:      defRoute,
 		Routes:       routes,
+		Matched:      matched,
 		VirtualHosts: ap.status.VirtualHosts,
+
+		TransportAPIVersion: ap.spec.TransportAPIVersion,
 	}, nil
 }
 
 func (apo *accessPolicyOIDC) convert(secret *core.Secret) (Oidc, error) {
+	for k := range apo.AuthParams {
+		if api.IsReservedAuthParam(k) {
+			return Oidc{}, errors.New("reserved authorization parameter", "name", k)
+		}
+	}
+
 	cb, err := url.Parse(apo.CallbackPath)
 	if err != nil {
 		return Oidc{}, err
 	}
 
+	li, err := url.Parse(apo.LoginPath)
+	if err != nil {
+		return Oidc{}, err
+	}
+
+	lo, err := url.Parse(apo.LogoutPath)
+	if err != nil {
+		return Oidc{}, err
+	}
+
+	fclo, err := url.Parse(apo.FrontChannelLogoutPath)
+	if err != nil {
+		return Oidc{}, err
+	}
+
+	cookie := accessPolicyOIDCCookie(apo.Cookie)
+
 	var clientId, clientSecret string
 	var tokenSecret []byte
+	var clientAuth ClientAuth
 	if secret != nil {
-		clientIdBytes, ok1 := secret.Data[apo.CredentialsSecret.ClientIDKey]
-		clientSecretBytes, ok2 := secret.Data[apo.CredentialsSecret.ClientSecretKey]
+		ref := apo.CredentialsSecret
+		clientIdBytes, ok1 := secret.Data[ref.ClientIDKey]
+		clientSecretBytes, ok2 := secret.Data[ref.ClientSecretKey]
 		var ok3 bool
-		tokenSecret, ok3 = secret.Data[apo.CredentialsSecret.TokenSecretKey]
+		tokenSecret, ok3 = secret.Data[ref.TokenSecretKey]
 
-		if !ok1 || !ok2 || !ok3 {
+		if !ok1 || (!ok2 && ref.UsesClientSecret()) || !ok3 {
 			return Oidc{}, errors.New("failed extracting credentials")
 		} else {
 			clientId = string(clientIdBytes)
 			clientSecret = string(clientSecretBytes)
 		}
+
+		key := secret.Data[ref.PrivateKeyKey]
+		keyId := secret.Data[ref.KeyIDKey]
+		cert := secret.Data[ref.CertificateKey]
+		clientAuth, err = newClientAuth(ref.ClientAuthMethod, clientId, clientSecret, key, keyId, cert)
+		if err != nil {
+			return Oidc{}, errors.Wrap(err, "failed setting up client authentication", "method", ref.ClientAuthMethod)
+		}
+	}
+
+	var bearerAudiences []string
+	if apo.BearerTokens != nil {
+		bearerAudiences = apo.BearerTokens.Audiences
 	}
 
 	return Oidc{
-		ClientId:     clientId,
-		ClientSecret: clientSecret,
-		TokenSecret:  tokenSecret,
-		Callback:     *cb,
+		ClientId:           clientId,
+		ClientSecret:       clientSecret,
+		ClientAuth:         clientAuth,
+		TokenSecret:        tokenSecret,
+		Callback:           *cb,
+		Login:              *li,
+		Logout:             *lo,
+		FrontChannelLogout: *fclo,
+		PKCE:               apo.PKCE,
+		Scopes:             apo.Scopes,
+		AuthParams:         apo.AuthParams,
+		Cookie:             cookie.convert(),
+		BearerAudiences:    bearerAudiences,
+		IdleTimeout:        apo.IdleTimeout.Duration,
+		MaxLifetime:        apo.MaxLifetime.Duration,
 	}, nil
 }
 
-func (apr *accessPolicyRoute) convert() Route {
+func (apoc *accessPolicyOIDCCookie) convert() Cookie {
+	var sameSite http.SameSite
+	switch apoc.SameSite {
+	case "Strict":
+		sameSite = http.SameSiteStrictMode
+	case "Lax":
+		sameSite = http.SameSiteLaxMode
+	case "None":
+		sameSite = http.SameSiteNoneMode
+	}
+
+	return Cookie{
+		Name:     apoc.Name,
+		Domain:   apoc.Domain,
+		Path:     apoc.Path,
+		Secure:   apoc.Secure,
+		SameSite: sameSite,
+		MaxAge:   apoc.MaxAge,
+	}
+}
+
+func (apr *accessPolicyRoute) convert() (Route, error) {
 	roles := accessPolicyRoles(apr.Roles)
 	headers := accessPolicyRouteHeaders(apr.Headers)
 
+	convHeaders, err := headers.convert()
+	if err != nil {
+		return Route{}, err
+	}
+
+	var accessTokenHeader string
+	if apr.ForwardAccessToken != nil {
+		accessTokenHeader = apr.ForwardAccessToken.Header
+	}
+
+	unauthd := accessPolicyRouteUnauthenticated(apr.Unauthenticated)
+	convUnauthd, err := unauthd.convert()
+	if err != nil {
+		return Route{}, err
+	}
+
+	var match *RouteMatch
+	if apr.Match != nil {
+		m := accessPolicyRouteMatch(*apr.Match)
+		conv, err := m.convert()
+		if err != nil {
+			return Route{}, err
+		}
+		match = &conv
+	}
+
+	expr, err := convertRoleExpression(apr.RoleExpression)
+	if err != nil {
+		return Route{}, err
+	}
+
 	return Route{
-		EnableAuthz: !apr.DisableEnforcement,
-		Roles:       roles.convert(),
-		Headers:     headers.convert(),
+		Match:             match,
+		EnableAuthz:       !apr.DisableEnforcement,
+		Roles:             roles.convert(),
+		RoleExpression:    expr,
+		Headers:           convHeaders,
+		AccessTokenHeader: accessTokenHeader,
+		Unauthenticated:   convUnauthd,
+	}, nil
+}
+func (apru *accessPolicyRouteUnauthenticated) convert() (Unauthenticated, error) {
+	rules := make([]HeaderRule, len(apru.APIHeaders))
+	for i, h := range apru.APIHeaders {
+		var re *regexp.Regexp
+		if h.Regex != "" {
+			var err error
+			re, err = regexp.Compile(h.Regex)
+			if err != nil {
+				return Unauthenticated{}, errors.Wrap(err, "invalid API header regex", "header", h.Name)
+			}
+		}
+
+		rules[i] = HeaderRule{Name: strings.ToLower(h.Name), Regex: re}
 	}
+
+	return Unauthenticated{
+		Status:     apru.Status,
+		Format:     apru.Format,
+		APIHeaders: rules,
+	}, nil
 }
+
+func (aprm *accessPolicyRouteMatch) convert() (RouteMatch, error) {
+	var re *regexp.Regexp
+	if aprm.Regex != "" {
+		var err error
+		re, err = regexp.Compile(aprm.Regex)
+		if err != nil {
+			return RouteMatch{}, errors.Wrap(err, "invalid route regex", "regex", aprm.Regex)
+		}
+	}
+
+	methods := make([]string, len(aprm.Methods))
+	for i, m := range aprm.Methods {
+		methods[i] = string(m)
+	}
+
+	return RouteMatch{
+		Prefix:  aprm.Prefix,
+		Path:    aprm.Path,
+		Regex:   re,
+		Methods: methods,
+	}, nil
+}
+
 func (apr *accessPolicyRoles) convert() []string {
 	roles := make([]string, len(*apr))
 	for i := range *apr {
@@ -100,21 +276,98 @@ func (apr *accessPolicyRoles) convert() []string {
 	return roles
 }
 
-func (aprh *accessPolicyRouteHeaders) convert() Headers {
+func (aprh *accessPolicyRouteHeaders) convert() (Headers, error) {
 	headers := make(Headers, len(*aprh))
 	for i, header := range *aprh {
 		header := accessPolicyRouteHeader(header)
-		headers[i] = header.convert()
+		conv, err := header.convert()
+		if err != nil {
+			return nil, err
+		}
+		headers[i] = conv
 	}
-	return headers
+	return headers, nil
 }
 
-func (aprh *accessPolicyRouteHeader) convert() Header {
+func (aprh *accessPolicyRouteHeader) convert() (Header, error) {
 	roles := accessPolicyRoles(aprh.Roles)
 
+	var tmpl *template.Template
+	if aprh.Template != "" {
+		var err error
+		tmpl, err = template.New(aprh.Name).
+			Funcs(templateFuncs).
+			Option("missingkey=zero").
+			Parse(aprh.Template)
+		if err != nil {
+			return Header{}, errors.Wrap(err, "invalid header template", "header", aprh.Name)
+		}
+	}
+
+	expr, err := convertRoleExpression(aprh.RoleExpression)
+	if err != nil {
+		return Header{}, errors.Wrap(err, "invalid header role expression", "header", aprh.Name)
+	}
+
 	return Header{
-		Name:  aprh.Name,
-		Value: aprh.Value,
-		Roles: roles.convert(),
+		Name:           aprh.Name,
+		Value:          aprh.Value,
+		Template:       tmpl,
+		Roles:          roles.convert(),
+		RoleExpression: expr,
+	}, nil
+}
+
+func convertRoleExpression(expr *api.AccessPolicyRoleExpression) (*RoleExpression, error) {
+	if expr == nil {
+		return nil, nil
+	}
+
+	conv := accessPolicyRoleExpression(*expr)
+	res, err := conv.convert()
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+func (apre *accessPolicyRoleExpression) convert() (RoleExpression, error) {
+	allOf, err := convertRoleExpressions(apre.AllOf)
+	if err != nil {
+		return RoleExpression{}, err
+	}
+	anyOf, err := convertRoleExpressions(apre.AnyOf)
+	if err != nil {
+		return RoleExpression{}, err
+	}
+	not, err := convertRoleExpression(apre.Not)
+	if err != nil {
+		return RoleExpression{}, err
+	}
+
+	return RoleExpression{
+		Role:  apre.Role,
+		AllOf: allOf,
+		AnyOf: anyOf,
+		Not:   not,
+	}, nil
+}
+
+func convertRoleExpressions(exprs []api.AccessPolicyRoleExpression) ([]RoleExpression, error) {
+	if exprs == nil {
+		return nil, nil
+	} else if len(exprs) == 0 {
+		return nil, errors.New("empty role expression list")
+	}
+
+	res := make([]RoleExpression, len(exprs))
+	for i := range exprs {
+		conv := accessPolicyRoleExpression(exprs[i])
+		var err error
+		res[i], err = conv.convert()
+		if err != nil {
+			return nil, err
+		}
 	}
+	return res, nil
 }
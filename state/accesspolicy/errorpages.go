@@ -0,0 +1,129 @@
+package accesspolicy
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/KnowitSolutions/istio-oidc/api"
+	"github.com/KnowitSolutions/istio-oidc/log/errors"
+	htmltemplate "html/template"
+	core "k8s.io/api/core/v1"
+	"strings"
+	texttemplate "text/template"
+	"text/template/parse"
+)
+
+const (
+	DeniedPage        = "denied"
+	BadRequestPage    = "bad-request"
+	IdpErrorPage      = "idp-error"
+	InternalErrorPage = "internal-error"
+)
+
+var errorPageNames = []string{DeniedPage, BadRequestPage, IdpErrorPage, InternalErrorPage}
+
+type ErrorPages struct {
+	ExposeRoles bool
+	html        map[string]*htmltemplate.Template
+	json        map[string]*texttemplate.Template
+}
+
+func NewErrorPages(spec api.AccessPolicyErrorPages, cm *core.ConfigMap) (ErrorPages, error) {
+	pages := ErrorPages{
+		ExposeRoles: spec.ExposeRoles,
+		html:        map[string]*htmltemplate.Template{},
+		json:        map[string]*texttemplate.Template{},
+	}
+
+	for _, name := range errorPageNames {
+		if src, ok := cm.Data[name+".html"]; ok {
+			tmpl, err := htmltemplate.New(name).Funcs(htmltemplate.FuncMap(templateFuncs)).Parse(src)
+			if err != nil {
+				return ErrorPages{}, errors.Wrap(err, "invalid error page", "page", name+".html")
+			}
+			pages.html[name] = tmpl
+		}
+
+		if src, ok := cm.Data[name+".json"]; ok {
+			tmpl, err := texttemplate.New(name).Funcs(templateFuncs).Funcs(jsonFuncs).Parse(src)
+			if err != nil {
+				return ErrorPages{}, errors.Wrap(err, "invalid error page", "page", name+".json")
+			}
+			for _, t := range tmpl.Templates() {
+				escapeJsonActions(t.Root)
+			}
+			pages.json[name] = tmpl
+		}
+	}
+
+	return pages, nil
+}
+
+var jsonFuncs = texttemplate.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+	"escapeJson": func(v interface{}) string {
+		b, _ := json.Marshal(fmt.Sprint(v))
+		return string(b[1 : len(b)-1])
+	},
+}
+
+// Like html/template, values printed by JSON pages are escaped by default so
+// they can be placed inside string literals. Output of json is left as is.
+func escapeJsonActions(node parse.Node) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, c := range n.Nodes {
+			escapeJsonActions(c)
+		}
+	case *parse.IfNode:
+		escapeJsonActions(n.List)
+		escapeJsonActions(n.ElseList)
+	case *parse.RangeNode:
+		escapeJsonActions(n.List)
+		escapeJsonActions(n.ElseList)
+	case *parse.WithNode:
+		escapeJsonActions(n.List)
+		escapeJsonActions(n.ElseList)
+	case *parse.ActionNode:
+		if len(n.Pipe.Decl) > 0 {
+			return
+		}
+
+		last := n.Pipe.Cmds[len(n.Pipe.Cmds)-1]
+		if ident, ok := last.Args[0].(*parse.IdentifierNode); ok && ident.Ident == "json" {
+			return
+		}
+
+		escape := &parse.CommandNode{NodeType: parse.NodeCommand, Pos: n.Pos, Args: []parse.Node{
+			parse.NewIdentifier("escapeJson").SetPos(n.Pos),
+		}}
+		n.Pipe.Cmds = append(n.Pipe.Cmds, escape)
+	}
+}
+
+func (ep ErrorPages) Render(name string, preferHtml bool, data interface{}) (string, string, error) {
+	html, hasHtml := ep.html[name]
+	json, hasJson := ep.json[name]
+
+	buf := &strings.Builder{}
+	if hasHtml && (preferHtml || !hasJson) {
+		err := html.Execute(buf, data)
+		if err != nil {
+			return "", "", errors.Wrap(err, "unable to render error page", "page", name+".html")
+		}
+		return buf.String(), "text/html; charset=utf-8", nil
+	} else if hasJson {
+		err := json.Execute(buf, data)
+		if err != nil {
+			return "", "", errors.Wrap(err, "unable to render error page", "page", name+".json")
+		}
+		return buf.String(), "application/json", nil
+	} else {
+		return "", "", nil
+	}
+}
@@ -0,0 +1,83 @@
+package accesspolicy
+
+import (
+	"encoding/json"
+	"github.com/KnowitSolutions/istio-oidc/api"
+	core "k8s.io/api/core/v1"
+	"reflect"
+	"testing"
+)
+
+type testPageData struct {
+	Error        string
+	URL          string
+	MissingRoles []string
+}
+
+func TestErrorPagesRender(t *testing.T) {
+	tests := []struct {
+		name        string
+		pages       map[string]string
+		preferHtml  bool
+		contentType string
+		body        string
+	}{
+		{"prefer html", map[string]string{"denied.html": "<p>{{.Error}}</p>", "denied.json": "{}"}, true, "text/html; charset=utf-8", "<p>a &lt;b&gt;</p>"},
+		{"prefer json", map[string]string{"denied.html": "<p>{{.Error}}</p>", "denied.json": "{}"}, false, "application/json", "{}"},
+		{"only html", map[string]string{"denied.html": "<p>{{.Error}}</p>"}, false, "text/html; charset=utf-8", "<p>a &lt;b&gt;</p>"},
+		{"only json", map[string]string{"denied.json": "{}"}, true, "application/json", "{}"},
+		{"none", map[string]string{}, true, "", ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			pages, err := NewErrorPages(api.AccessPolicyErrorPages{}, &core.ConfigMap{Data: test.pages})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			body, contentType, err := pages.Render(DeniedPage, test.preferHtml, &testPageData{Error: "a <b>"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if contentType != test.contentType || body != test.body {
+				t.Errorf("Render() = %q, %q, want %q, %q", body, contentType, test.body, test.contentType)
+			}
+		})
+	}
+}
+
+func TestErrorPagesJsonEscaping(t *testing.T) {
+	src := `{"error": "{{.Error}}", "url": "{{.URL}}", "roles": {{json .MissingRoles}}, "joined": "{{join .MissingRoles ", "}}"` +
+		`{{range .MissingRoles}}, "{{.}}": true{{end}}}`
+	pages, err := NewErrorPages(api.AccessPolicyErrorPages{}, &core.ConfigMap{Data: map[string]string{"denied.json": src}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := &testPageData{
+		Error:        "bad \"quote\"\nand \\ slash",
+		URL:          `https://app.example.com/?x="}`,
+		MissingRoles: []string{`a"b`},
+	}
+	body, _, err := pages.Render(DeniedPage, false, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(body), &got); err != nil {
+		t.Fatalf("invalid JSON %q: %v", body, err)
+	}
+
+	want := map[string]interface{}{
+		"error":  data.Error,
+		"url":    data.URL,
+		"roles":  []interface{}{`a"b`},
+		"joined": `a"b`,
+		`a"b`:    true,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Render() = %v, want %v", got, want)
+	}
+}
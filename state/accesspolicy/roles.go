@@ -0,0 +1,65 @@
+package accesspolicy
+
+import "strings"
+
+type RoleExpression struct {
+	Role  string
+	AllOf []RoleExpression
+	AnyOf []RoleExpression
+	Not   *RoleExpression
+}
+
+func (re *RoleExpression) Matches(roles map[string]bool) bool {
+	switch {
+	case re.Role != "":
+		return roles[re.Role]
+	case re.AllOf != nil:
+		for i := range re.AllOf {
+			if !re.AllOf[i].Matches(roles) {
+				return false
+			}
+		}
+		return len(re.AllOf) > 0
+	case re.AnyOf != nil:
+		for i := range re.AnyOf {
+			if re.AnyOf[i].Matches(roles) {
+				return true
+			}
+		}
+		return false
+	case re.Not != nil:
+		return !re.Not.Matches(roles)
+	default:
+		return false
+	}
+}
+
+func (re *RoleExpression) String() string {
+	switch {
+	case re.Role != "":
+		return re.Role
+	case re.AllOf != nil:
+		return re.join(re.AllOf, " AND ")
+	case re.AnyOf != nil:
+		return re.join(re.AnyOf, " OR ")
+	case re.Not != nil:
+		return "NOT " + re.Not.group()
+	default:
+		return ""
+	}
+}
+
+func (re *RoleExpression) join(exprs []RoleExpression, sep string) string {
+	parts := make([]string, len(exprs))
+	for i := range exprs {
+		parts[i] = exprs[i].group()
+	}
+	return strings.Join(parts, sep)
+}
+
+func (re *RoleExpression) group() string {
+	if (re.AllOf != nil && len(re.AllOf) > 1) || (re.AnyOf != nil && len(re.AnyOf) > 1) {
+		return "(" + re.String() + ")"
+	}
+	return re.String()
+}
@@ -0,0 +1,117 @@
+package accesspolicy
+
+import (
+	"github.com/KnowitSolutions/istio-oidc/api"
+	"testing"
+)
+
+func role(name string) RoleExpression {
+	return RoleExpression{Role: name}
+}
+
+func TestRoleExpressionMatches(t *testing.T) {
+	roles := map[string]bool{"admin": true, "user": true}
+
+	tests := []struct {
+		name string
+		expr RoleExpression
+		want bool
+	}{
+		{"role present", role("admin"), true},
+		{"role absent", role("guest"), false},
+		{"all of present", RoleExpression{AllOf: []RoleExpression{role("admin"), role("user")}}, true},
+		{"all of partial", RoleExpression{AllOf: []RoleExpression{role("admin"), role("guest")}}, false},
+		{"all of empty", RoleExpression{AllOf: []RoleExpression{}}, false},
+		{"any of partial", RoleExpression{AnyOf: []RoleExpression{role("guest"), role("user")}}, true},
+		{"any of absent", RoleExpression{AnyOf: []RoleExpression{role("guest"), role("other")}}, false},
+		{"any of empty", RoleExpression{AnyOf: []RoleExpression{}}, false},
+		{"not present", RoleExpression{Not: &RoleExpression{Role: "admin"}}, false},
+		{"not absent", RoleExpression{Not: &RoleExpression{Role: "guest"}}, true},
+		{
+			"nested",
+			RoleExpression{AllOf: []RoleExpression{
+				role("user"),
+				{AnyOf: []RoleExpression{role("guest"), role("admin")}},
+				{Not: &RoleExpression{Role: "banned"}},
+			}},
+			true,
+		},
+		{"empty", RoleExpression{}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.expr.Matches(roles); got != test.want {
+				t.Errorf("Matches() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestRoleExpressionString(t *testing.T) {
+	tests := []struct {
+		name string
+		expr RoleExpression
+		want string
+	}{
+		{"role", role("admin"), "admin"},
+		{"all of", RoleExpression{AllOf: []RoleExpression{role("a"), role("b")}}, "a AND b"},
+		{"any of", RoleExpression{AnyOf: []RoleExpression{role("a"), role("b")}}, "a OR b"},
+		{"not", RoleExpression{Not: &RoleExpression{Role: "a"}}, "NOT a"},
+		{
+			"nested",
+			RoleExpression{AllOf: []RoleExpression{
+				role("a"),
+				{AnyOf: []RoleExpression{role("b"), role("c")}},
+			}},
+			"a AND (b OR c)",
+		},
+		{
+			"not group",
+			RoleExpression{Not: &RoleExpression{AnyOf: []RoleExpression{role("a"), role("b")}}},
+			"NOT (a OR b)",
+		},
+		{
+			"single element group",
+			RoleExpression{AllOf: []RoleExpression{role("a"), {AnyOf: []RoleExpression{role("b")}}}},
+			"a AND b",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.expr.String(); got != test.want {
+				t.Errorf("String() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestRoleExpressionValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		expr api.AccessPolicyRoleExpression
+		err  bool
+	}{
+		{"role", api.AccessPolicyRoleExpression{Role: "a"}, false},
+		{"all of", api.AccessPolicyRoleExpression{AllOf: []api.AccessPolicyRoleExpression{{Role: "a"}}}, false},
+		{"all of empty", api.AccessPolicyRoleExpression{AllOf: []api.AccessPolicyRoleExpression{}}, true},
+		{"any of empty", api.AccessPolicyRoleExpression{AnyOf: []api.AccessPolicyRoleExpression{}}, true},
+		{
+			"nested empty",
+			api.AccessPolicyRoleExpression{Not: &api.AccessPolicyRoleExpression{AllOf: []api.AccessPolicyRoleExpression{}}},
+			true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if errs := test.expr.Validate(nil); (len(errs) > 0) != test.err {
+				t.Errorf("Validate() = %v, want error %v", errs, test.err)
+			}
+			if _, err := convertRoleExpression(&test.expr); (err != nil) != test.err {
+				t.Errorf("convertRoleExpression() error = %v, want error %v", err, test.err)
+			}
+		})
+	}
+}
@@ -1,9 +1,16 @@
 package accesspolicy
 
 import (
+	"github.com/KnowitSolutions/istio-oidc/api"
 	"github.com/KnowitSolutions/istio-oidc/state/openidprovider"
 	"golang.org/x/oauth2"
+	"net"
+	"net/http"
 	"net/url"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
 )
 
 const (
@@ -11,46 +18,337 @@ const (
 	RouteKey = "route"
 )
 
+var tokenParams = []string{"audience", "resource"}
+
+var templateFuncs = template.FuncMap{
+	"join": strings.Join,
+	"first": func(vals []string) string {
+		if len(vals) == 0 {
+			return ""
+		}
+		return vals[0]
+	},
+}
+
 type AccessPolicy struct {
 	Name         string
 	Oidc         Oidc
 	Default      Route
 	Routes       Routes
+	Matched      []Route
+	ErrorPages   ErrorPages
 	VirtualHosts []string
+
+	TransportAPIVersion string
 }
 
 type Oidc struct {
-	Provider     openidprovider.OpenIdProvider
-	ClientId     string
-	ClientSecret string
-	TokenSecret  []byte
-	Callback     url.URL
+	Provider           openidprovider.OpenIdProvider
+	ClientId           string
+	ClientSecret       string
+	ClientAuth         ClientAuth
+	TokenSecret        []byte
+	Callback           url.URL
+	Login              url.URL
+	Logout             url.URL
+	FrontChannelLogout url.URL
+	PKCE               *bool
+	Scopes             []string
+	AuthParams         map[string]string
+	Cookie             Cookie
+	BearerAudiences    []string
+	IdleTimeout        time.Duration
+	MaxLifetime        time.Duration
+}
+
+type Cookie struct {
+	Name     string
+	Domain   string
+	Path     string
+	Secure   bool
+	SameSite http.SameSite
+	MaxAge   int
 }
 
 type Routes map[string]Route
 type Route struct {
-	EnableAuthz bool
-	Roles       []string
-	Headers     Headers
+	Match             *RouteMatch
+	EnableAuthz       bool
+	Roles             []string
+	RoleExpression    *RoleExpression
+	Headers           Headers
+	AccessTokenHeader string
+	Unauthenticated   Unauthenticated
+}
+
+type Unauthenticated struct {
+	Status     int
+	Format     string
+	APIHeaders []HeaderRule
+}
+
+type HeaderRule struct {
+	Name  string
+	Regex *regexp.Regexp
 }
 
 type Headers []Header
 type Header struct {
-	Name  string
-	Value string
-	Roles []string
+	Name           string
+	Value          string
+	Template       *template.Template
+	Roles          []string
+	RoleExpression *RoleExpression
+}
+
+type RouteMatch struct {
+	Prefix  string
+	Path    string
+	Regex   *regexp.Regexp
+	Methods []string
+}
+
+func (ap *AccessPolicy) MatchRoute(method, path string) Route {
+	for _, route := range ap.Matched {
+		if route.Match.Matches(method, path) {
+			return route
+		}
+	}
+
+	return ap.Default
+}
+
+func (rm *RouteMatch) Matches(method, path string) bool {
+	if len(rm.Methods) > 0 {
+		found := false
+		for _, m := range rm.Methods {
+			if strings.EqualFold(m, method) {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return false
+		}
+	}
+
+	switch {
+	case rm.Prefix != "":
+		return strings.HasPrefix(path, rm.Prefix)
+	case rm.Path != "":
+		return path == rm.Path
+	case rm.Regex != nil:
+		return rm.Regex.MatchString(path)
+	default:
+		return true
+	}
+}
+
+func (rm *RouteMatch) String() string {
+	var path string
+	switch {
+	case rm.Prefix != "":
+		path = rm.Prefix + "*"
+	case rm.Path != "":
+		path = rm.Path
+	case rm.Regex != nil:
+		path = "~" + rm.Regex.String()
+	default:
+		path = "*"
+	}
+
+	if len(rm.Methods) == 0 {
+		return path
+	}
+	return strings.Join(rm.Methods, ",") + " " + path
+}
+
+func (ap *AccessPolicy) ForwardsAccessToken() bool {
+	if ap.Default.AccessTokenHeader != "" {
+		return true
+	}
+
+	for _, route := range ap.Routes {
+		if route.AccessTokenHeader != "" {
+			return true
+		}
+	}
+
+	for _, route := range ap.Matched {
+		if route.AccessTokenHeader != "" {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (ap *AccessPolicy) IsVirtualHost(host string) bool {
+	return ap.matchVirtualHost(host, true)
+}
+
+// IsRedirectHost is like IsVirtualHost, except that a catch-all virtual host
+// does not match, as that would allow redirecting anywhere
+func (ap *AccessPolicy) IsRedirectHost(host string) bool {
+	return ap.matchVirtualHost(host, false)
+}
+
+func (ap *AccessPolicy) matchVirtualHost(host string, catchAll bool) bool {
+	hostname, port := splitHost(host)
+
+	for _, vhost := range ap.VirtualHosts {
+		vhostname, vport := splitHost(vhost)
+		if idx := strings.IndexByte(vhostname, '/'); idx != -1 {
+			vhostname = vhostname[idx+1:]
+		}
+
+		if port != "" && port != vport {
+			continue
+		}
+
+		if vhostname == "*" {
+			if catchAll {
+				return true
+			}
+		} else if strings.EqualFold(vhostname, hostname) {
+			return true
+		} else if strings.HasPrefix(vhostname, "*.") &&
+			len(hostname) > len(vhostname)-1 &&
+			strings.EqualFold(hostname[len(hostname)-len(vhostname)+1:], vhostname[1:]) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func splitHost(host string) (string, string) {
+	hostname, port, err := net.SplitHostPort(host)
+	if err != nil {
+		return host, ""
+	}
+	return hostname, port
+}
+
+func (c Cookie) Make(value string, url url.URL) *http.Cookie {
+	return &http.Cookie{
+		Name:     c.Name,
+		Value:    value,
+		Domain:   c.Domain,
+		Path:     c.Path,
+		MaxAge:   c.MaxAge,
+		Secure:   c.IsSecure(url),
+		HttpOnly: true,
+		SameSite: c.SameSite,
+	}
+}
+
+func (c Cookie) Clear(url url.URL) *http.Cookie {
+	cookie := c.Make("", url)
+	cookie.MaxAge = -1
+	return cookie
+}
+
+func (c Cookie) IsSecure(url url.URL) bool {
+	return c.Secure || url.Scheme == "https"
 }
 
 func (oidc Oidc) IsCallback(url url.URL) bool {
 	return url.Path == oidc.Callback.Path
 }
 
+func (oidc Oidc) IsLogin(url url.URL) bool {
+	return oidc.Login.Path != "" && url.Path == oidc.Login.Path
+}
+
+func (oidc Oidc) IsLogout(url url.URL) bool {
+	return oidc.Logout.Path != "" && url.Path == oidc.Logout.Path
+}
+
+func (oidc Oidc) IsFrontChannelLogout(url url.URL) bool {
+	return oidc.FrontChannelLogout.Path != "" && url.Path == oidc.FrontChannelLogout.Path
+}
+
+func (oidc Oidc) AcceptsBearerTokens() bool {
+	return len(oidc.BearerAudiences) > 0
+}
+
+func (oidc Oidc) UsePKCE() bool {
+	if oidc.PKCE != nil {
+		return *oidc.PKCE
+	} else {
+		return oidc.Provider.PKCE()
+	}
+}
+
 func (oidc Oidc) OAuth2(url url.URL) *oauth2.Config {
+	var secret string
+	if oidc.ClientAuth.sendsSecret() {
+		secret = oidc.ClientSecret
+	}
+
+	endpoint := oidc.Provider.Endpoint()
+	endpoint.AuthStyle = oidc.ClientAuth.authStyle()
+
 	return &oauth2.Config{
 		ClientID:     oidc.ClientId,
-		ClientSecret: oidc.ClientSecret,
-		Endpoint:     oidc.Provider.Endpoint(),
+		ClientSecret: secret,
+		Endpoint:     endpoint,
 		RedirectURL:  url.ResolveReference(&oidc.Callback).String(),
-		Scopes:       []string{"openid"},
+		Scopes:       oidc.OAuth2Scopes(),
+	}
+}
+
+func (oidc Oidc) AuthCodeOptions() []oauth2.AuthCodeOption {
+	params := oidc.authParams()
+	opts := make([]oauth2.AuthCodeOption, 0, len(params))
+	for k, v := range params {
+		opts = append(opts, oauth2.SetAuthURLParam(k, v))
+	}
+	return opts
+}
+
+func (oidc Oidc) TokenOptions() []oauth2.AuthCodeOption {
+	params := oidc.authParams()
+	opts := make([]oauth2.AuthCodeOption, 0, len(tokenParams))
+	for _, k := range tokenParams {
+		v, ok := params[k]
+		if ok {
+			opts = append(opts, oauth2.SetAuthURLParam(k, v))
+		}
+	}
+	return opts
+}
+
+func (oidc Oidc) OAuth2Scopes() []string {
+	scopes := oidc.Scopes
+	if len(scopes) == 0 {
+		scopes = oidc.Provider.Scopes()
+	}
+
+	res := []string{"openid"}
+	for _, scope := range scopes {
+		if scope != "openid" {
+			res = append(res, scope)
+		}
+	}
+	return res
+}
+
+func (oidc Oidc) authParams() map[string]string {
+	def := oidc.Provider.AuthParams()
+	params := make(map[string]string, len(def)+len(oidc.AuthParams))
+	for k, v := range def {
+		params[k] = v
+	}
+	for k, v := range oidc.AuthParams {
+		params[k] = v
+	}
+	for k := range params {
+		if api.IsReservedAuthParam(k) {
+			delete(params, k)
+		}
 	}
+	return params
 }
@@ -0,0 +1,129 @@
+package accesspolicy
+
+import (
+	"github.com/KnowitSolutions/istio-oidc/api"
+	"golang.org/x/oauth2"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestCookieSecure(t *testing.T) {
+	tests := []struct {
+		name   string
+		secure bool
+		url    string
+		want   bool
+	}{
+		{"https", false, "https://example.com/", true},
+		{"http", false, "http://example.com/", false},
+		{"forced on http", true, "http://example.com/", true},
+		{"forced on https", true, "https://example.com/", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			u, _ := url.Parse(test.url)
+			c := Cookie{Name: "bearer", Path: "/", Secure: test.secure}
+
+			if got := c.Make("value", *u).Secure; got != test.want {
+				t.Errorf("Make().Secure = %v, want %v", got, test.want)
+			}
+			if got := c.Clear(*u).Secure; got != test.want {
+				t.Errorf("Clear().Secure = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestRouteMatchMatches(t *testing.T) {
+	tests := []struct {
+		name   string
+		match  RouteMatch
+		method string
+		path   string
+		want   bool
+	}{
+		{"prefix", RouteMatch{Prefix: "/static/"}, "GET", "/static/x", true},
+		{"prefix miss", RouteMatch{Prefix: "/static/"}, "GET", "/admin/x", false},
+		{"path", RouteMatch{Path: "/admin"}, "GET", "/admin", true},
+		{"path miss", RouteMatch{Path: "/admin"}, "GET", "/admin/x", false},
+		{"regex", RouteMatch{Regex: regexp.MustCompile(`^/api/v[0-9]+/`)}, "GET", "/api/v2/x", true},
+		{"regex miss", RouteMatch{Regex: regexp.MustCompile(`^/api/v[0-9]+/`)}, "GET", "/api/x", false},
+		{"any", RouteMatch{}, "GET", "/anything", true},
+		{"method", RouteMatch{Prefix: "/", Methods: []string{"POST", "PUT"}}, "put", "/x", true},
+		{"method miss", RouteMatch{Prefix: "/", Methods: []string{"POST", "PUT"}}, "GET", "/x", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.match.Matches(test.method, test.path); got != test.want {
+				t.Errorf("Matches() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestAuthCodeOptions(t *testing.T) {
+	oidc := Oidc{AuthParams: map[string]string{
+		"state":                 "fixed",
+		"redirect_uri":          "https://evil.example/cb",
+		"client_id":             "other",
+		"response_type":         "token",
+		"scope":                 "admin",
+		"nonce":                 "fixed",
+		"code_challenge":        "fixed",
+		"code_challenge_method": "plain",
+		"prompt":                "login",
+	}}
+
+	cfg := oauth2.Config{ClientID: "client", RedirectURL: "https://app.example.com/cb", Endpoint: oauth2.Endpoint{AuthURL: "https://idp/auth"}}
+	loc, err := url.Parse(cfg.AuthCodeURL("state", oidc.AuthCodeOptions()...))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := url.Values{
+		"client_id":     {"client"},
+		"redirect_uri":  {"https://app.example.com/cb"},
+		"response_type": {"code"},
+		"state":         {"state"},
+		"prompt":        {"login"},
+	}
+	if got := loc.Query(); !reflect.DeepEqual(got, want) {
+		t.Errorf("AuthCodeURL() query = %v, want %v", got, want)
+	}
+}
+
+func TestReservedAuthParams(t *testing.T) {
+	tests := []struct {
+		name  string
+		param string
+		err   bool
+	}{
+		{"state", "state", true},
+		{"redirect uri", "redirect_uri", true},
+		{"code challenge", "code_challenge_method", true},
+		{"prompt", "prompt", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ap := &api.AccessPolicy{}
+			ap.Spec.OIDC.AuthParams = map[string]string{test.param: "value"}
+
+			reserved := false
+			for _, err := range ap.Validate() {
+				reserved = reserved || strings.Contains(err.Error(), "reserved")
+			}
+			if reserved != test.err {
+				t.Errorf("Validate() reserved error = %v, want %v", reserved, test.err)
+			}
+			if _, err := New(ap, nil); (err != nil) != test.err {
+				t.Errorf("New() error = %v, want error %v", err, test.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,134 @@
+package openidprovider
+
+import (
+	"context"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestExtractBearerData(t *testing.T) {
+	idp := newTestIdp(t)
+
+	now := time.Now()
+	valid := func() map[string]interface{} {
+		return map[string]interface{}{
+			"iss":   idp.URL,
+			"aud":   "api",
+			"exp":   now.Add(time.Minute).Unix(),
+			"sub":   "user",
+			"roles": []string{"token"},
+		}
+	}
+	with := func(key string, val interface{}) map[string]interface{} {
+		claims := valid()
+		claims[key] = val
+		return claims
+	}
+	without := func(key string) map[string]interface{} {
+		claims := valid()
+		delete(claims, key)
+		return claims
+	}
+
+	tests := []struct {
+		name  string
+		from  from
+		token string
+		roles []string
+		err   bool
+	}{
+		{name: "access token roles", from: AccessToken, token: idp.sign(t, valid()), roles: []string{"token"}},
+		{name: "introspection roles", from: Introspection, token: idp.sign(t, valid()), roles: []string{"introspected"}},
+		{name: "userinfo roles", from: UserInfo, token: idp.sign(t, valid()), roles: []string{"userinfo"}},
+		{name: "userinfo subject mismatch", from: UserInfo, token: idp.sign(t, with("sub", "other")), err: true},
+		{name: "wrong audience", token: idp.sign(t, with("aud", "client")), err: true},
+		{name: "wrong issuer", token: idp.sign(t, with("iss", "https://other")), err: true},
+		{name: "expired", token: idp.sign(t, with("exp", now.Add(-time.Hour).Unix())), err: true},
+		{name: "missing exp", token: idp.sign(t, without("exp")), err: true},
+		{name: "ID token nonce", token: idp.sign(t, with("nonce", "nonce")), err: true},
+		{name: "ID token at_hash", token: idp.sign(t, with("at_hash", "hash")), err: true},
+		{name: "opaque", token: "opaque", err: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			op := idp.op
+			op.maps = []roleMapping{{from: test.from, path: []string{"roles"}}}
+
+			data, err := extractBearerData(context.Background(), op, test.token, []string{"api"}, Credentials{ClientId: "client"})
+			if test.err {
+				if err == nil {
+					t.Fatalf("extractBearerData() = %+v, want error", data)
+				}
+				return
+			} else if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(data.Roles[""], test.roles) {
+				t.Errorf("roles = %v, want %v", data.Roles[""], test.roles)
+			}
+		})
+	}
+}
+
+func TestBearerCache(t *testing.T) {
+	idp := newTestIdp(t)
+	op := idp.op
+	op.bearers = &bearerCache{}
+	op.maps = []roleMapping{
+		{from: Introspection, path: []string{"roles"}},
+		{from: UserInfo, path: []string{"roles"}},
+	}
+
+	claims := map[string]interface{}{
+		"iss": idp.URL,
+		"aud": "api",
+		"exp": time.Now().Add(time.Minute).Unix(),
+		"sub": "user",
+	}
+	tok := idp.sign(t, claims)
+	creds := Credentials{ClientId: "client"}
+
+	for i := 0; i < 3; i++ {
+		data, err := extractBearerData(context.Background(), op, tok, []string{"api"}, creds)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := []string{"introspected", "userinfo"}; !reflect.DeepEqual(data.Roles[""], want) {
+			t.Errorf("roles = %v, want %v", data.Roles[""], want)
+		}
+	}
+	introspections, userInfos := atomic.LoadInt32(&idp.introspections), atomic.LoadInt32(&idp.userInfos)
+	if introspections != 1 || userInfos != 1 {
+		t.Errorf("introspections = %d, userinfos = %d, want 1", introspections, userInfos)
+	}
+
+	if _, err := extractBearerData(context.Background(), op, tok, []string{"other"}, creds); err == nil {
+		t.Error("extractBearerData() with cached token and wrong audience succeeded")
+	}
+
+	claims["exp"] = time.Now().Add(-time.Second).Unix()
+	if _, err := extractBearerData(context.Background(), op, idp.sign(t, claims), []string{"api"}, creds); err == nil {
+		t.Error("extractBearerData() with expired token succeeded")
+	}
+}
+
+func TestBearerCacheExpiry(t *testing.T) {
+	bc := &bearerCache{}
+	key := bearerKey("token", "client")
+
+	bc.set(key, bearerEntry{expiry: time.Now().Add(time.Hour)})
+	if entry, ok := bc.get(key); !ok {
+		t.Fatal("get() missed fresh entry")
+	} else if max := time.Now().Add(bearerCacheLifetime); entry.expiry.After(max) {
+		t.Errorf("expiry = %v, want at most %v", entry.expiry, max)
+	}
+
+	bc.set(key, bearerEntry{expiry: time.Now().Add(-time.Second)})
+	if _, ok := bc.get(key); ok {
+		t.Error("get() returned expired entry")
+	}
+}
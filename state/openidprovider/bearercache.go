@@ -0,0 +1,59 @@
+package openidprovider
+
+import (
+	"crypto/sha256"
+	"sync"
+	"time"
+)
+
+const bearerCacheLifetime = time.Minute
+
+type bearerCache struct {
+	mu      sync.Mutex
+	entries map[[sha256.Size]byte]bearerEntry
+	cleaned time.Time
+}
+
+type bearerEntry struct {
+	introspection map[string]interface{}
+	userInfo      map[string]interface{}
+	expiry        time.Time
+}
+
+func bearerKey(tok string, clientId string) [sha256.Size]byte {
+	return sha256.Sum256([]byte(clientId + "\x00" + tok))
+}
+
+func (bc *bearerCache) get(key [sha256.Size]byte) (bearerEntry, bool) {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+
+	entry, ok := bc.entries[key]
+	if !ok || !time.Now().Before(entry.expiry) {
+		return bearerEntry{}, false
+	}
+	return entry, true
+}
+
+func (bc *bearerCache) set(key [sha256.Size]byte, entry bearerEntry) {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+
+	now := time.Now()
+	if max := now.Add(bearerCacheLifetime); entry.expiry.After(max) {
+		entry.expiry = max
+	}
+
+	if bc.entries == nil {
+		bc.entries = make(map[[sha256.Size]byte]bearerEntry)
+	} else if now.Sub(bc.cleaned) > bearerCacheLifetime {
+		for k, e := range bc.entries {
+			if !now.Before(e.expiry) {
+				delete(bc.entries, k)
+			}
+		}
+		bc.cleaned = now
+	}
+
+	bc.entries[key] = entry
+}
@@ -8,6 +8,7 @@ import (
 
 type openIdProviderSpec api.OpenIDProviderSpec
 type openIDProviderRoleMappings []api.OpenIDProviderRoleMapping
+type openIDProviderClaimMappings []api.OpenIDProviderClaimMapping
 
 func New(ctx context.Context, op *api.OpenIDProvider) (OpenIdProvider, error) {
 	spec := openIdProviderSpec(op.Spec)
@@ -15,6 +16,13 @@ func New(ctx context.Context, op *api.OpenIDProvider) (OpenIdProvider, error) {
 }
 
 func (op openIdProviderSpec) convert(ctx context.Context, name string) (OpenIdProvider, error) {
+	for k := range op.AuthParams {
+		if api.IsReservedAuthParam(k) {
+			err := errors.New("reserved authorization parameter", "name", k)
+			return OpenIdProvider{}, err
+		}
+	}
+
 	addr := op.Issuer + "/.well-known/openid-configuration"
 
 	cfg := openIdConfiguration{}
@@ -24,6 +32,11 @@ func (op openIdProviderSpec) convert(ctx context.Context, name string) (OpenIdPr
 		return OpenIdProvider{}, err
 	}
 
+	if op.IntrospectionEndpoint != "" {
+		cfg.IntrospectionEndpoint = op.IntrospectionEndpoint
+		cfg.MTLSEndpointAliases.IntrospectionEndpoint = ""
+	}
+
 	roleMappings := openIDProviderRoleMappings(op.RoleMappings)
 	maps, err := roleMappings.convert()
 	if err != nil {
@@ -31,7 +44,36 @@ func (op openIdProviderSpec) convert(ctx context.Context, name string) (OpenIdPr
 		return OpenIdProvider{}, err
 	}
 
-	return OpenIdProvider{Name: name, cfg: cfg, maps: maps}, nil
+	claimMappings := openIDProviderClaimMappings(op.ClaimMappings)
+	claimMaps, err := claimMappings.convert()
+	if err != nil {
+		err = errors.Wrap(err, "unable to parse claim mappings")
+		return OpenIdProvider{}, err
+	}
+
+	provider := OpenIdProvider{
+		Name:    name,
+		cfg:     cfg,
+		maps:    maps,
+		claims:  claimMaps,
+		pkce:    op.PKCE,
+		keys:    &keyCache{},
+		bearers: &bearerCache{},
+		scopes:  op.Scopes,
+		params:  op.AuthParams,
+
+		refreshLifetime: op.RefreshTokenLifetime.Duration,
+	}
+
+	if provider.uses(Introspection) && cfg.IntrospectionEndpoint == "" {
+		err = errors.New("introspection mapping without introspection endpoint", "issuer", op.Issuer)
+		return OpenIdProvider{}, err
+	} else if provider.uses(UserInfo) && cfg.UserInfoEndpoint == "" {
+		err = errors.New("userinfo mapping without userinfo endpoint", "issuer", op.Issuer)
+		return OpenIdProvider{}, err
+	}
+
+	return provider, nil
 }
 
 func (oprm openIDProviderRoleMappings) convert() ([]roleMapping, error) {
@@ -52,3 +94,22 @@ func (oprm openIDProviderRoleMappings) convert() ([]roleMapping, error) {
 	}
 	return maps, nil
 }
+
+func (opcm openIDProviderClaimMappings) convert() ([]claimMapping, error) {
+	maps := make([]claimMapping, len(opcm))
+	for i, cm := range opcm {
+		from, ok := fromStrToConst[cm.From]
+		if !ok {
+			err := errors.New("invalid from", "from", cm.From)
+			return nil, err
+		}
+
+		path, _, err := parseRolePath([]rune(cm.Path))
+		if err != nil {
+			return nil, err
+		}
+
+		maps[i] = claimMapping{cm.Name, from, path}
+	}
+	return maps, nil
+}
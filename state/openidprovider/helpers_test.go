@@ -0,0 +1,79 @@
+package openidprovider
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"gopkg.in/square/go-jose.v2"
+	"gopkg.in/square/go-jose.v2/jwt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+type testIdp struct {
+	*httptest.Server
+	key *rsa.PrivateKey
+	op  OpenIdProvider
+
+	introspections int32
+	userInfos      int32
+}
+
+func newTestIdp(t *testing.T) *testIdp {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	idp := &testIdp{key: key}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		jwk := jose.JSONWebKey{Key: key.Public(), KeyID: "test", Algorithm: "RS256", Use: "sig"}
+		_ = json.NewEncoder(w).Encode(jose.JSONWebKeySet{Keys: []jose.JSONWebKey{jwk}})
+	})
+	mux.HandleFunc("/introspect", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&idp.introspections, 1)
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"active": true, "roles": []string{"introspected"}})
+	})
+	mux.HandleFunc("/userinfo", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&idp.userInfos, 1)
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"sub": "user", "roles": []string{"userinfo"}})
+	})
+
+	idp.Server = httptest.NewServer(mux)
+	t.Cleanup(idp.Close)
+
+	idp.op = OpenIdProvider{
+		Name: "default/test",
+		cfg: openIdConfiguration{
+			Issuer:                idp.URL,
+			JWKsURI:               idp.URL + "/jwks",
+			IntrospectionEndpoint: idp.URL + "/introspect",
+			UserInfoEndpoint:      idp.URL + "/userinfo",
+		},
+		keys: &keyCache{},
+	}
+	return idp
+}
+
+func (idp *testIdp) sign(t *testing.T, claims map[string]interface{}) string {
+	return signWith(t, idp.key, "test", claims)
+}
+
+func signWith(t *testing.T, key *rsa.PrivateKey, kid string, claims map[string]interface{}) string {
+	opts := (&jose.SignerOptions{}).WithHeader("kid", kid)
+	sig, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.RS256, Key: key}, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tok, err := jwt.Signed(sig).Claims(claims).CompactSerialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tok
+}
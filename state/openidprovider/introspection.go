@@ -0,0 +1,73 @@
+package openidprovider
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/KnowitSolutions/istio-oidc/log/errors"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+type Credentials struct {
+	ClientId     string
+	ClientSecret string
+}
+
+func introspect(ctx context.Context, op OpenIdProvider, tok string, creds Credentials) (map[string]interface{}, error) {
+	endpoint := op.cfg.IntrospectionEndpoint
+	if endpoint == "" {
+		return nil, errors.New("provider has no introspection endpoint")
+	}
+
+	form := url.Values{"token": {tok}, "token_type_hint": {"access_token"}}
+	if creds.ClientSecret == "" {
+		form.Set("client_id", creds.ClientId)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed preparing request", "url", endpoint)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if creds.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(creds.ClientId), url.QueryEscape(creds.ClientSecret))
+	}
+
+	res, err := contextClient(ctx).Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "communication error", "url", endpoint)
+	}
+	defer func() { _ = res.Body.Close() }()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, errors.New("unexpected introspection status", "url", endpoint, "status", res.StatusCode)
+	}
+
+	data := make(map[string]interface{}, 0)
+	err = json.NewDecoder(res.Body).Decode(&data)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed decoding JSON", "url", endpoint)
+	}
+
+	if active, _ := data["active"].(bool); !active {
+		return nil, errors.New("access token is not active")
+	}
+
+	return data, nil
+}
+
+func (op OpenIdProvider) uses(src from) bool {
+	for _, rm := range op.maps {
+		if rm.from == src {
+			return true
+		}
+	}
+	for _, cm := range op.claims {
+		if cm.from == src {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,57 @@
+package openidprovider
+
+import (
+	"context"
+	"github.com/KnowitSolutions/istio-oidc/log/errors"
+	"gopkg.in/square/go-jose.v2"
+	"sync"
+	"time"
+)
+
+const (
+	keyCacheLifetime    = 5 * time.Minute
+	keyCacheMinInterval = 10 * time.Second
+)
+
+type keyCache struct {
+	mu      sync.Mutex
+	keys    jose.JSONWebKeySet
+	fetched time.Time
+}
+
+func (op OpenIdProvider) keySet(ctx context.Context, kid string) (jose.JSONWebKeySet, error) {
+	if op.keys == nil {
+		jwks := jose.JSONWebKeySet{}
+		err := doJsonRequest(ctx, op.cfg.JWKsURI, &jwks)
+		return jwks, err
+	}
+
+	kc := op.keys
+	kc.mu.Lock()
+	defer kc.mu.Unlock()
+
+	age := time.Since(kc.fetched)
+	if age < keyCacheMinInterval {
+		return kc.keys, nil
+	} else if age < keyCacheLifetime && (kid == "" || len(kc.keys.Key(kid)) > 0) {
+		return kc.keys, nil
+	}
+
+	jwks := jose.JSONWebKeySet{}
+	err := doJsonRequest(ctx, op.cfg.JWKsURI, &jwks)
+	if err != nil {
+		return jose.JSONWebKeySet{}, errors.Wrap(err, "failed fetching JWKs")
+	}
+
+	kc.keys = jwks
+	kc.fetched = time.Now()
+	return kc.keys, nil
+}
+
+func keyId(tok string) string {
+	parsed, err := jose.ParseSigned(tok)
+	if err != nil || len(parsed.Signatures) == 0 {
+		return ""
+	}
+	return parsed.Signatures[0].Header.KeyID
+}
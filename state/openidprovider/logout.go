@@ -0,0 +1,57 @@
+package openidprovider
+
+import (
+	"context"
+	"github.com/KnowitSolutions/istio-oidc/log/errors"
+	"gopkg.in/square/go-jose.v2/jwt"
+	"time"
+)
+
+const backChannelLogoutEvent = "http://schemas.openid.net/event/backchannel-logout"
+
+type logoutClaims struct {
+	jwt.Claims
+	SessionId string                 `json:"sid"`
+	Nonce     *string                `json:"nonce"`
+	Events    map[string]interface{} `json:"events"`
+}
+
+func extractLogoutData(ctx context.Context, op OpenIdProvider, tok string, clientId string) (LogoutData, error) {
+	jwks, err := op.keySet(ctx, keyId(tok))
+	if err != nil {
+		return LogoutData{}, errors.Wrap(err, "unable to retrieve JWKs")
+	}
+
+	parsed, err := jwt.ParseSigned(tok)
+	if err != nil {
+		return LogoutData{}, errors.Wrap(err, "failed parsing logout token")
+	}
+
+	lt := logoutClaims{}
+	err = parsed.Claims(&jwks, &lt)
+	if err != nil {
+		return LogoutData{}, errors.Wrap(err, "failed deserializing logout token claims")
+	}
+
+	exp := jwt.Expected{Issuer: op.cfg.Issuer, Audience: jwt.Audience{clientId}, Time: time.Now()}
+	err = lt.ValidateWithLeeway(exp, jwt.DefaultLeeway)
+	if err != nil {
+		return LogoutData{}, errors.Wrap(err, "failed validating logout token")
+	}
+
+	if lt.IssuedAt == nil {
+		return LogoutData{}, errors.New("logout token missing iat")
+	} else if _, ok := lt.Events[backChannelLogoutEvent]; !ok {
+		return LogoutData{}, errors.New("logout token missing back-channel logout event")
+	} else if lt.SessionId == "" && lt.Subject == "" {
+		return LogoutData{}, errors.New("logout token missing both sid and sub")
+	} else if lt.Nonce != nil {
+		return LogoutData{}, errors.New("logout token contains nonce")
+	}
+
+	return LogoutData{
+		Issuer:    lt.Issuer,
+		Subject:   lt.Subject,
+		SessionId: lt.SessionId,
+	}, nil
+}
@@ -0,0 +1,85 @@
+package openidprovider
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"testing"
+	"time"
+)
+
+func TestExtractLogoutData(t *testing.T) {
+	idp := newTestIdp(t)
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	valid := func() map[string]interface{} {
+		return map[string]interface{}{
+			"iss":    idp.URL,
+			"aud":    "client",
+			"iat":    now.Unix(),
+			"exp":    now.Add(time.Minute).Unix(),
+			"sub":    "user",
+			"sid":    "session",
+			"events": map[string]interface{}{backChannelLogoutEvent: map[string]interface{}{}},
+		}
+	}
+	without := func(key string) map[string]interface{} {
+		claims := valid()
+		delete(claims, key)
+		return claims
+	}
+	with := func(key string, val interface{}) map[string]interface{} {
+		claims := valid()
+		claims[key] = val
+		return claims
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		want  LogoutData
+		err   bool
+	}{
+		{name: "valid", token: idp.sign(t, valid()), want: LogoutData{Issuer: idp.URL, Subject: "user", SessionId: "session"}},
+		{name: "sid only", token: idp.sign(t, without("sub")), want: LogoutData{Issuer: idp.URL, SessionId: "session"}},
+		{name: "sub only", token: idp.sign(t, without("sid")), want: LogoutData{Issuer: idp.URL, Subject: "user"}},
+		{name: "missing sid and sub", token: idp.sign(t, map[string]interface{}{
+			"iss":    idp.URL,
+			"aud":    "client",
+			"iat":    now.Unix(),
+			"events": map[string]interface{}{backChannelLogoutEvent: map[string]interface{}{}},
+		}), err: true},
+		{name: "wrong issuer", token: idp.sign(t, with("iss", "https://other")), err: true},
+		{name: "wrong audience", token: idp.sign(t, with("aud", "other")), err: true},
+		{name: "expired", token: idp.sign(t, with("exp", now.Add(-time.Hour).Unix())), err: true},
+		{name: "missing iat", token: idp.sign(t, without("iat")), err: true},
+		{name: "missing event", token: idp.sign(t, without("events")), err: true},
+		{name: "wrong event", token: idp.sign(t, with("events", map[string]interface{}{"other": map[string]interface{}{}})), err: true},
+		{name: "nonce", token: idp.sign(t, with("nonce", "nonce")), err: true},
+		{name: "wrong key", token: signWith(t, other, "test", valid()), err: true},
+		{name: "unknown key", token: signWith(t, other, "other", valid()), err: true},
+		{name: "malformed", token: "not-a-token", err: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data, err := extractLogoutData(context.Background(), idp.op, test.token, "client")
+			if test.err {
+				if err == nil {
+					t.Fatalf("extractLogoutData() = %+v, want error", data)
+				}
+				return
+			} else if err != nil {
+				t.Fatal(err)
+			}
+
+			if data != test.want {
+				t.Errorf("extractLogoutData() = %+v, want %+v", data, test.want)
+			}
+		})
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"github.com/KnowitSolutions/istio-oidc/log/errors"
+	"golang.org/x/oauth2"
 	"net/http"
 )
 
@@ -26,3 +27,10 @@ func doJsonRequest(ctx context.Context, url string, data interface{}) error {
 
 	return nil
 }
+
+func contextClient(ctx context.Context) *http.Client {
+	if client, ok := ctx.Value(oauth2.HTTPClient).(*http.Client); ok {
+		return client
+	}
+	return http.DefaultClient
+}
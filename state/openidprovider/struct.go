@@ -3,19 +3,41 @@ package openidprovider
 import (
 	"context"
 	"golang.org/x/oauth2"
+	"net/url"
 	"time"
 )
 
 type OpenIdProvider struct {
-	Name string
-	cfg  openIdConfiguration
-	maps []roleMapping
+	Name    string
+	cfg     openIdConfiguration
+	maps    []roleMapping
+	claims  []claimMapping
+	pkce    bool
+	keys    *keyCache
+	bearers *bearerCache
+
+	refreshLifetime time.Duration
+
+	scopes []string
+	params map[string]string
 }
 
 type openIdConfiguration struct {
+	Issuer                string `json:"issuer"`
 	AuthorizationEndpoint string `json:"authorization_endpoint"`
 	TokenEndpoint         string `json:"token_endpoint"`
 	JWKsURI               string `json:"jwks_uri"`
+	EndSessionEndpoint    string `json:"end_session_endpoint"`
+	IntrospectionEndpoint string `json:"introspection_endpoint"`
+	UserInfoEndpoint      string `json:"userinfo_endpoint"`
+
+	MTLSEndpointAliases mtlsEndpointAliases `json:"mtls_endpoint_aliases"`
+}
+
+type mtlsEndpointAliases struct {
+	TokenEndpoint         string `json:"token_endpoint"`
+	IntrospectionEndpoint string `json:"introspection_endpoint"`
+	UserInfoEndpoint      string `json:"userinfo_endpoint"`
 }
 
 type from int
@@ -23,12 +45,16 @@ type from int
 const (
 	AccessToken = iota
 	IdToken
+	Introspection
+	UserInfo
 )
 
 var fromStrToConst = map[string]from{
-	"":            AccessToken,
-	"accesstoken": AccessToken,
-	"idtoken":     IdToken,
+	"":              AccessToken,
+	"accesstoken":   AccessToken,
+	"idtoken":       IdToken,
+	"introspection": Introspection,
+	"userinfo":      UserInfo,
 }
 
 type roleMapping struct {
@@ -37,6 +63,16 @@ type roleMapping struct {
 	path   []string
 }
 
+type claimMapping struct {
+	name string
+	from from
+	path []string
+}
+
+func (op OpenIdProvider) Issuer() string {
+	return op.cfg.Issuer
+}
+
 func (op OpenIdProvider) Endpoint() oauth2.Endpoint {
 	return oauth2.Endpoint{
 		AuthURL:  op.cfg.AuthorizationEndpoint,
@@ -44,12 +80,78 @@ func (op OpenIdProvider) Endpoint() oauth2.Endpoint {
 	}
 }
 
-func (op OpenIdProvider) TokenData(ctx context.Context, tok oauth2.Token) (TokenData, error) {
-	return extractTokenData(ctx, op, tok)
+func (op OpenIdProvider) WithMTLSAliases() OpenIdProvider {
+	aliases := op.cfg.MTLSEndpointAliases
+	if aliases.TokenEndpoint != "" {
+		op.cfg.TokenEndpoint = aliases.TokenEndpoint
+	}
+	if aliases.IntrospectionEndpoint != "" {
+		op.cfg.IntrospectionEndpoint = aliases.IntrospectionEndpoint
+	}
+	if aliases.UserInfoEndpoint != "" {
+		op.cfg.UserInfoEndpoint = aliases.UserInfoEndpoint
+	}
+	return op
+}
+
+func (op OpenIdProvider) PKCE() bool {
+	return op.pkce
+}
+
+func (op OpenIdProvider) Scopes() []string {
+	return op.scopes
+}
+
+func (op OpenIdProvider) AuthParams() map[string]string {
+	return op.params
+}
+
+func (op OpenIdProvider) EndSessionURL(idToken string, redirect string) (string, bool) {
+	if op.cfg.EndSessionEndpoint == "" {
+		return "", false
+	}
+
+	loc, err := url.Parse(op.cfg.EndSessionEndpoint)
+	if err != nil {
+		return "", false
+	}
+
+	query := loc.Query()
+	if idToken != "" {
+		query.Set("id_token_hint", idToken)
+	}
+	if redirect != "" {
+		query.Set("post_logout_redirect_uri", redirect)
+	}
+	loc.RawQuery = query.Encode()
+
+	return loc.String(), true
+}
+
+func (op OpenIdProvider) TokenData(ctx context.Context, tok oauth2.Token, nonce, prevIdToken string, creds Credentials) (TokenData, error) {
+	return extractTokenData(ctx, op, tok, nonce, prevIdToken, creds)
+}
+
+func (op OpenIdProvider) LogoutData(ctx context.Context, tok string, clientId string) (LogoutData, error) {
+	return extractLogoutData(ctx, op, tok, clientId)
+}
+
+func (op OpenIdProvider) BearerData(ctx context.Context, tok string, audiences []string, creds Credentials) (TokenData, error) {
+	return extractBearerData(ctx, op, tok, audiences, creds)
+}
+
+type LogoutData struct {
+	Issuer    string
+	Subject   string
+	SessionId string
 }
 
 type TokenData struct {
-	Subject string
-	Expiry  time.Time
-	Roles   map[string][]string
+	Issuer    string
+	Subject   string
+	SessionId string
+	IdToken   string
+	Expiry    time.Time
+	Roles     map[string][]string
+	Claims    map[string][]string
 }
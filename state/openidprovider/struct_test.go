@@ -0,0 +1,90 @@
+package openidprovider
+
+import (
+	"context"
+	"github.com/KnowitSolutions/istio-oidc/api"
+	"strings"
+	"testing"
+)
+
+func TestWithMTLSAliases(t *testing.T) {
+	cfg := openIdConfiguration{
+		TokenEndpoint:         "https://idp/token",
+		IntrospectionEndpoint: "https://idp/introspect",
+		UserInfoEndpoint:      "https://idp/userinfo",
+	}
+
+	tests := []struct {
+		name    string
+		aliases mtlsEndpointAliases
+		want    openIdConfiguration
+	}{
+		{
+			name: "no aliases",
+			want: cfg,
+		},
+		{
+			name:    "token alias",
+			aliases: mtlsEndpointAliases{TokenEndpoint: "https://mtls.idp/token"},
+			want: openIdConfiguration{
+				TokenEndpoint:         "https://mtls.idp/token",
+				IntrospectionEndpoint: "https://idp/introspect",
+				UserInfoEndpoint:      "https://idp/userinfo",
+			},
+		},
+		{
+			name: "all aliases",
+			aliases: mtlsEndpointAliases{
+				TokenEndpoint:         "https://mtls.idp/token",
+				IntrospectionEndpoint: "https://mtls.idp/introspect",
+				UserInfoEndpoint:      "https://mtls.idp/userinfo",
+			},
+			want: openIdConfiguration{
+				TokenEndpoint:         "https://mtls.idp/token",
+				IntrospectionEndpoint: "https://mtls.idp/introspect",
+				UserInfoEndpoint:      "https://mtls.idp/userinfo",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			op := OpenIdProvider{cfg: cfg}
+			op.cfg.MTLSEndpointAliases = test.aliases
+
+			got := op.WithMTLSAliases()
+			got.cfg.MTLSEndpointAliases = mtlsEndpointAliases{}
+			if got.cfg != test.want {
+				t.Errorf("WithMTLSAliases() = %+v, want %+v", got.cfg, test.want)
+			}
+			if got.Endpoint().TokenURL != test.want.TokenEndpoint {
+				t.Errorf("Endpoint().TokenURL = %q, want %q", got.Endpoint().TokenURL, test.want.TokenEndpoint)
+			}
+		})
+	}
+}
+
+func TestReservedAuthParams(t *testing.T) {
+	tests := []struct {
+		name  string
+		param string
+	}{
+		{"state", "state"},
+		{"redirect uri", "redirect_uri"},
+		{"nonce", "nonce"},
+		{"code challenge", "code_challenge"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			op := &api.OpenIDProvider{}
+			op.Spec.Issuer = "http://127.0.0.1:0"
+			op.Spec.AuthParams = map[string]string{test.param: "value"}
+
+			_, err := New(context.Background(), op)
+			if err == nil || !strings.Contains(err.Error(), "reserved") {
+				t.Errorf("New() error = %v, want reserved parameter error", err)
+			}
+		})
+	}
+}
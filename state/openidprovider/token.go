@@ -2,6 +2,7 @@ package openidprovider
 
 import (
 	"context"
+	"github.com/KnowitSolutions/istio-oidc/config"
 	"github.com/KnowitSolutions/istio-oidc/log/errors"
 	"golang.org/x/oauth2"
 	"gopkg.in/square/go-jose.v2"
@@ -9,56 +10,224 @@ import (
 	"time"
 )
 
-func extractTokenData(ctx context.Context, op OpenIdProvider, tok oauth2.Token) (TokenData, error) {
-	jwks := jose.JSONWebKeySet{}
-	err := doJsonRequest(ctx, op.cfg.JWKsURI, &jwks)
+var (
+	ErrMissingIdToken = errors.New("token response is missing ID token")
+	ErrNonceMismatch  = errors.New("ID token nonce mismatch")
+)
+
+func extractTokenData(ctx context.Context, op OpenIdProvider, tok oauth2.Token, nonce, prevIdToken string, creds Credentials) (TokenData, error) {
+	rawIdt, _ := tok.Extra("id_token").(string)
+	jwks, err := op.keySet(ctx, keyId(rawIdt))
 	if err != nil {
 		return TokenData{}, errors.Wrap(err, "unable to retrieve JWKs")
 	}
 
 	at := make(map[string]interface{}, 0)
-	err = claims(tok.AccessToken, jwks, &at)
+	if _, err := jose.ParseSigned(tok.AccessToken); err == nil {
+		atJwks, err := op.keySet(ctx, keyId(tok.AccessToken))
+		if err != nil {
+			return TokenData{}, errors.Wrap(err, "unable to retrieve JWKs")
+		}
+
+		err = claims(tok.AccessToken, atJwks, &at)
+		if err != nil {
+			return TokenData{}, errors.Wrap(err, "unable to get access token claims")
+		}
+	}
+
+	var it map[string]interface{}
+	if op.uses(Introspection) {
+		it, err = introspect(ctx, op, tok.AccessToken, creds)
+		if err != nil {
+			return TokenData{}, errors.Wrap(err, "unable to introspect access token")
+		}
+	}
+
+	expiry := refreshExpiry(op, tok)
+
+	idt := make(map[string]interface{}, 0)
+	if rawIdt != "" {
+		err = claims(rawIdt, jwks, &idt)
+		if err != nil {
+			return TokenData{}, errors.Wrap(err, "unable to get ID token claims")
+		}
+	} else if prevIdToken != "" && nonce == "" {
+		rawIdt = prevIdToken
+		err = claimsUnexpired(rawIdt, jwks, &idt)
+		if err != nil {
+			return TokenData{}, errors.Wrap(err, "unable to get previous ID token claims")
+		}
+	} else {
+		return TokenData{}, ErrMissingIdToken
+	}
+
+	if nonce != "" && idt["nonce"] != nonce {
+		return TokenData{}, errors.Wrap(ErrNonceMismatch, "", "nonce", idt["nonce"])
+	}
+
+	var ui map[string]interface{}
+	if op.uses(UserInfo) {
+		ui, err = userInfo(ctx, op, tok.AccessToken, jwks)
+		if err != nil {
+			return TokenData{}, errors.Wrap(err, "unable to get userinfo")
+		} else if ui["sub"] != idt["sub"] {
+			return TokenData{}, errors.New("userinfo subject mismatch", "sub", ui["sub"])
+		}
+	}
+
+	tokens := map[from]map[string]interface{}{
+		AccessToken:   at,
+		IdToken:       idt,
+		Introspection: it,
+		UserInfo:      ui,
+	}
+
+	roles, extraClaims, err := mapClaims(op, tokens)
 	if err != nil {
-		return TokenData{}, errors.Wrap(err, "unable to get access token claims")
+		return TokenData{}, err
 	}
 
-	rt := jwt.Claims{}
-	err = claimsUnsafe(tok.RefreshToken, &rt)
+	iss, _ := idt["iss"].(string)
+	sub, _ := idt["sub"].(string)
+	sid, _ := idt["sid"].(string)
+	return TokenData{
+		Issuer:    iss,
+		Subject:   sub,
+		SessionId: sid,
+		IdToken:   rawIdt,
+		Expiry:    expiry,
+		Roles:     roles,
+		Claims:    extraClaims,
+	}, nil
+}
+
+func extractBearerData(ctx context.Context, op OpenIdProvider, tok string, audiences []string, creds Credentials) (TokenData, error) {
+	jwks, err := op.keySet(ctx, keyId(tok))
 	if err != nil {
-		return TokenData{}, errors.Wrap(err, "unable to get refresh token claims")
+		return TokenData{}, errors.Wrap(err, "unable to retrieve JWKs")
 	}
 
-	idt := make(map[string]interface{}, 0)
-	err = claims(tok.Extra("id_token").(string), jwks, &idt)
+	parsed, err := jwt.ParseSigned(tok)
 	if err != nil {
-		return TokenData{}, errors.Wrap(err, "unable to get ID token claims")
+		return TokenData{}, errors.Wrap(err, "failed parsing bearer token")
 	}
 
-	roles := make(map[string][]string, 0)
-	for _, rm := range op.maps {
-		var tok map[string]interface{}
-		switch rm.from {
-		case AccessToken:
-			tok = at
-		case IdToken:
-			tok = idt
+	def := jwt.Claims{}
+	bt := make(map[string]interface{}, 0)
+	err = parsed.Claims(&jwks, &def, &bt)
+	if err != nil {
+		return TokenData{}, errors.Wrap(err, "failed deserializing bearer token claims")
+	}
+
+	exp := jwt.Expected{Issuer: op.cfg.Issuer, Time: time.Now()}
+	err = def.ValidateWithLeeway(exp, 0)
+	if err != nil {
+		return TokenData{}, errors.Wrap(err, "failed validating bearer token")
+	} else if def.Expiry == nil {
+		return TokenData{}, errors.New("bearer token missing exp")
+	}
+
+	var aud bool
+	for _, a := range audiences {
+		aud = aud || def.Audience.Contains(a)
+	}
+	if !aud {
+		return TokenData{}, errors.New("bearer token audience mismatch", "aud", def.Audience)
+	}
+
+	_, hasNonce := bt["nonce"]
+	_, hasAtHash := bt["at_hash"]
+	if hasNonce || hasAtHash {
+		return TokenData{}, errors.New("bearer token is an ID token")
+	}
+
+	it, ui, err := bearerLookups(ctx, op, tok, def.Subject, jwks, def.Expiry.Time(), creds)
+	if err != nil {
+		return TokenData{}, err
+	}
+
+	tokens := map[from]map[string]interface{}{
+		AccessToken:   bt,
+		IdToken:       bt,
+		Introspection: it,
+		UserInfo:      ui,
+	}
+
+	roles, extraClaims, err := mapClaims(op, tokens)
+	if err != nil {
+		return TokenData{}, err
+	}
+
+	return TokenData{
+		Issuer:  def.Issuer,
+		Subject: def.Subject,
+		Expiry:  def.Expiry.Time(),
+		Roles:   roles,
+		Claims:  extraClaims,
+	}, nil
+}
+
+func bearerLookups(ctx context.Context, op OpenIdProvider, tok, subject string, jwks jose.JSONWebKeySet, expiry time.Time, creds Credentials) (map[string]interface{}, map[string]interface{}, error) {
+	if !op.uses(Introspection) && !op.uses(UserInfo) {
+		return nil, nil, nil
+	}
+
+	key := bearerKey(tok, creds.ClientId)
+	if op.bearers != nil {
+		if entry, ok := op.bearers.get(key); ok {
+			return entry.introspection, entry.userInfo, nil
+		}
+	}
+
+	var err error
+	var it map[string]interface{}
+	if op.uses(Introspection) {
+		it, err = introspect(ctx, op, tok, creds)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "unable to introspect bearer token")
 		}
+	}
+
+	var ui map[string]interface{}
+	if op.uses(UserInfo) {
+		ui, err = userInfo(ctx, op, tok, jwks)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "unable to get userinfo")
+		} else if ui["sub"] != subject {
+			return nil, nil, errors.New("userinfo subject mismatch", "sub", ui["sub"])
+		}
+	}
+
+	if op.bearers != nil {
+		op.bearers.set(key, bearerEntry{it, ui, expiry})
+	}
+	return it, ui, nil
+}
 
-		extracted, err := extractRoles(rm.path, tok)
+func mapClaims(op OpenIdProvider, tokens map[from]map[string]interface{}) (map[string][]string, map[string][]string, error) {
+	roles := make(map[string][]string, 0)
+	for _, rm := range op.maps {
+		extracted, err := extractRoles(rm.path, tokens[rm.from])
 		if err != nil {
 			err = errors.Wrap(err, "failed extracting roles")
-			return TokenData{}, err
+			return nil, nil, err
 		}
 
 		roles[rm.prefix] = append(roles[rm.prefix], extracted...)
 	}
 
-	sub, _ := idt["sub"].(string)
-	return TokenData{
-		Subject: sub,
-		Expiry:  rt.Expiry.Time(),
-		Roles:   roles,
-	}, nil
+	extraClaims := make(map[string][]string, len(op.claims))
+	for _, cm := range op.claims {
+		extracted, err := extractRoles(cm.path, tokens[cm.from])
+		if err != nil {
+			err = errors.Wrap(err, "failed extracting claims", "claim", cm.name)
+			return nil, nil, err
+		}
+
+		extraClaims[cm.name] = append(extraClaims[cm.name], extracted...)
+	}
+
+	return roles, extraClaims, nil
 }
 
 func claims(tok string, jwks jose.JSONWebKeySet, claims interface{}) error {
@@ -87,6 +256,41 @@ func claims(tok string, jwks jose.JSONWebKeySet, claims interface{}) error {
 	return nil
 }
 
+func claimsUnexpired(tok string, jwks jose.JSONWebKeySet, claims interface{}) error {
+	parsed, err := jwt.ParseSigned(tok)
+	if err != nil {
+		return errors.Wrap(err, "failed parsing token", "token", tok)
+	}
+
+	err = parsed.Claims(&jwks, claims)
+	if err != nil {
+		return errors.Wrap(err, "failed deserializing claims", "token", tok)
+	}
+
+	return nil
+}
+
+func refreshExpiry(op OpenIdProvider, tok oauth2.Token) time.Time {
+	if tok.RefreshToken == "" {
+		if !tok.Expiry.IsZero() {
+			return tok.Expiry
+		}
+		return time.Now().Add(config.Sessions.RefreshLifetime)
+	}
+
+	rt := jwt.Claims{}
+	err := claimsUnsafe(tok.RefreshToken, &rt)
+	if err == nil && rt.Expiry != nil {
+		return rt.Expiry.Time()
+	}
+
+	lifetime := op.refreshLifetime
+	if lifetime == 0 {
+		lifetime = config.Sessions.RefreshLifetime
+	}
+	return time.Now().Add(lifetime)
+}
+
 func claimsUnsafe(tok string, claims interface{}) error {
 	parsed, err := jwt.ParseSigned(tok)
 	if err != nil {
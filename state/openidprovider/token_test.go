@@ -0,0 +1,121 @@
+package openidprovider
+
+import (
+	"context"
+	"github.com/KnowitSolutions/istio-oidc/config"
+	"github.com/KnowitSolutions/istio-oidc/log/errors"
+	"golang.org/x/oauth2"
+	"testing"
+	"time"
+)
+
+func TestRefreshExpiry(t *testing.T) {
+	defer func(d time.Duration) { config.Sessions.RefreshLifetime = d }(config.Sessions.RefreshLifetime)
+	config.Sessions.RefreshLifetime = 24 * time.Hour
+
+	idp := newTestIdp(t)
+	now := time.Now().Truncate(time.Second)
+
+	tests := []struct {
+		name     string
+		lifetime time.Duration
+		token    oauth2.Token
+		want     time.Time
+	}{
+		{
+			name:  "jwt refresh token",
+			token: oauth2.Token{RefreshToken: idp.sign(t, map[string]interface{}{"exp": now.Add(2 * time.Hour).Unix()})},
+			want:  now.Add(2 * time.Hour),
+		},
+		{
+			name:  "jwt refresh token without exp",
+			token: oauth2.Token{RefreshToken: idp.sign(t, map[string]interface{}{"sub": "user"})},
+			want:  now.Add(24 * time.Hour),
+		},
+		{
+			name:  "opaque refresh token",
+			token: oauth2.Token{RefreshToken: "opaque"},
+			want:  now.Add(24 * time.Hour),
+		},
+		{
+			name:     "opaque refresh token with provider lifetime",
+			lifetime: time.Hour,
+			token:    oauth2.Token{RefreshToken: "opaque"},
+			want:     now.Add(time.Hour),
+		},
+		{
+			name:  "no refresh token",
+			token: oauth2.Token{Expiry: now.Add(5 * time.Minute)},
+			want:  now.Add(5 * time.Minute),
+		},
+		{
+			name:  "no refresh token or expiry",
+			token: oauth2.Token{},
+			want:  now.Add(24 * time.Hour),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			op := OpenIdProvider{refreshLifetime: test.lifetime}
+			got := refreshExpiry(op, test.token)
+			if diff := got.Sub(test.want); diff < -time.Second || diff > 2*time.Second {
+				t.Errorf("refreshExpiry() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestExtractTokenDataIdToken(t *testing.T) {
+	idp := newTestIdp(t)
+	now := time.Now()
+	idToken := func(nonce string, exp time.Time) string {
+		return idp.sign(t, map[string]interface{}{
+			"iss":   idp.URL,
+			"aud":   "client",
+			"sub":   "user",
+			"exp":   exp.Unix(),
+			"nonce": nonce,
+		})
+	}
+	withIdToken := func(idt string) oauth2.Token {
+		tok := oauth2.Token{AccessToken: "opaque", Expiry: now.Add(time.Minute)}
+		return *tok.WithExtra(map[string]interface{}{"id_token": idt})
+	}
+
+	tests := []struct {
+		name   string
+		token  oauth2.Token
+		nonce  string
+		prev   string
+		target error
+		err    bool
+	}{
+		{name: "matching nonce", token: withIdToken(idToken("nonce", now.Add(time.Hour))), nonce: "nonce"},
+		{name: "nonce mismatch", token: withIdToken(idToken("other", now.Add(time.Hour))), nonce: "nonce", target: ErrNonceMismatch},
+		{name: "missing ID token", token: oauth2.Token{AccessToken: "opaque"}, nonce: "nonce", target: ErrMissingIdToken},
+		{name: "refresh reuses previous ID token", token: oauth2.Token{AccessToken: "opaque"}, prev: idToken("nonce", now.Add(-time.Hour))},
+		{name: "refresh without previous ID token", token: oauth2.Token{AccessToken: "opaque"}, target: ErrMissingIdToken},
+		{name: "expired ID token", token: withIdToken(idToken("nonce", now.Add(-time.Hour))), nonce: "nonce", err: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data, err := extractTokenData(context.Background(), idp.op, test.token, test.nonce, test.prev, Credentials{})
+			if test.target != nil || test.err {
+				if err == nil {
+					t.Fatalf("extractTokenData() = %+v, want error", data)
+				} else if test.target != nil && !errors.Is(err, test.target) {
+					t.Errorf("extractTokenData() error = %v, want %v", err, test.target)
+				}
+				return
+			} else if err != nil {
+				t.Fatal(err)
+			}
+
+			if data.Subject != "user" {
+				t.Errorf("subject = %q, want %q", data.Subject, "user")
+			}
+		})
+	}
+}
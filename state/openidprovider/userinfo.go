@@ -0,0 +1,56 @@
+package openidprovider
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/KnowitSolutions/istio-oidc/log/errors"
+	"gopkg.in/square/go-jose.v2"
+	"io/ioutil"
+	"mime"
+	"net/http"
+)
+
+func userInfo(ctx context.Context, op OpenIdProvider, tok string, jwks jose.JSONWebKeySet) (map[string]interface{}, error) {
+	endpoint := op.cfg.UserInfoEndpoint
+	if endpoint == "" {
+		return nil, errors.New("provider has no userinfo endpoint")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed preparing request", "url", endpoint)
+	}
+	req.Header.Set("Authorization", "Bearer "+tok)
+	req.Header.Set("Accept", "application/json, application/jwt")
+
+	res, err := contextClient(ctx).Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "communication error", "url", endpoint)
+	}
+	defer func() { _ = res.Body.Close() }()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, errors.New("unexpected userinfo status", "url", endpoint, "status", res.StatusCode)
+	}
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed reading response", "url", endpoint)
+	}
+
+	data := make(map[string]interface{}, 0)
+	mediaType, _, _ := mime.ParseMediaType(res.Header.Get("Content-Type"))
+	if mediaType == "application/jwt" {
+		err = claims(string(body), jwks, &data)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed validating signed userinfo", "url", endpoint)
+		}
+	} else {
+		err = json.Unmarshal(body, &data)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed decoding JSON", "url", endpoint)
+		}
+	}
+
+	return data, nil
+}
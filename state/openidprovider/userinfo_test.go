@@ -0,0 +1,74 @@
+package openidprovider
+
+import (
+	"context"
+	"golang.org/x/oauth2"
+	"net/http"
+	"testing"
+)
+
+type countingTransport struct {
+	count int
+}
+
+func (t *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.count++
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestContextClient(t *testing.T) {
+	idp := newTestIdp(t)
+
+	tests := []struct {
+		name   string
+		call   func(context.Context) error
+		client bool
+	}{
+		{
+			name: "userinfo with context client",
+			call: func(ctx context.Context) error {
+				_, err := userInfo(ctx, idp.op, "token", idp.op.keys.keys)
+				return err
+			},
+			client: true,
+		},
+		{
+			name: "introspection with context client",
+			call: func(ctx context.Context) error {
+				_, err := introspect(ctx, idp.op, "token", Credentials{ClientId: "client"})
+				return err
+			},
+			client: true,
+		},
+		{
+			name: "userinfo without context client",
+			call: func(ctx context.Context) error {
+				_, err := userInfo(ctx, idp.op, "token", idp.op.keys.keys)
+				return err
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			transport := &countingTransport{}
+			ctx := context.Background()
+			if test.client {
+				ctx = context.WithValue(ctx, oauth2.HTTPClient, &http.Client{Transport: transport})
+			}
+
+			err := test.call(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			want := 0
+			if test.client {
+				want = 1
+			}
+			if transport.count != want {
+				t.Errorf("context client used %d times, want %d", transport.count, want)
+			}
+		})
+	}
+}
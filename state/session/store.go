@@ -10,9 +10,17 @@ import (
 )
 
 type Session struct {
-	Id           string
-	RefreshToken string
-	Expiry       time.Time
+	Id                string
+	Issuer            string
+	Subject           string
+	SessionId         string
+	RefreshToken      string
+	IdToken           string
+	Expiry            time.Time
+	AccessToken       string
+	AccessTokenExpiry time.Time
+	Created           time.Time
+	LastSeen          time.Time
 }
 
 type Stamp struct {
@@ -23,11 +31,15 @@ type Stamp struct {
 type Stamped struct {
 	Session
 	Stamp
+	Deleted bool
 }
 
 type Store interface {
 	Get(string) (Session, bool)
 	Set(Stamped) (Stamped, error)
+	Delete(Stamped) (Stamped, error)
+	Touch(string, time.Time) bool
+	DeleteWhere(func(Session) bool) []Stamped
 	Stream(map[string]uint64) <-chan Stamped
 }
 
@@ -35,8 +47,9 @@ type sessionStore struct {
 	id   string
 	curr uint64
 
-	lookup map[string]Session
-	store  map[string]*list.List
+	lookup     map[string]Stamped
+	tombstones map[string]time.Time
+	store      map[string]*list.List
 	mu     sync.RWMutex
 	delMu  sync.RWMutex
 }
@@ -45,8 +58,9 @@ func NewSessionStore(peerId string) (Store, error) {
 	ss := &sessionStore{
 		id: peerId,
 
-		lookup: map[string]Session{},
-		store:  map[string]*list.List{},
+		lookup:     map[string]Stamped{},
+		tombstones: map[string]time.Time{},
+		store:      map[string]*list.List{},
 	}
 
 	go ss.cleaner()
@@ -58,13 +72,17 @@ func (ss *sessionStore) Get(id string) (Session, bool) {
 	defer ss.mu.RUnlock()
 
 	sess, ok := ss.lookup[id]
-	return sess, ok
+	return sess.Session, ok
 }
 
 func (ss *sessionStore) Set(sess Stamped) (Stamped, error) {
 	ss.mu.Lock()
 	defer ss.mu.Unlock()
 
+	return ss.set(sess)
+}
+
+func (ss *sessionStore) set(sess Stamped) (Stamped, error) {
 	if sess.Stamp == (Stamp{}) {
 		ss.curr++
 		sess.Stamp = Stamp{PeerId: ss.id, Serial: ss.curr}
@@ -88,11 +106,79 @@ func (ss *sessionStore) Set(sess Stamped) (Stamped, error) {
 	}
 
 	ss.store[sess.Stamp.PeerId].PushBack(sess)
-	ss.lookup[sess.Id] = sess.Session
+	if sess.Deleted {
+		delete(ss.lookup, sess.Id)
+		if sess.Expiry.After(ss.tombstones[sess.Id]) {
+			ss.tombstones[sess.Id] = sess.Expiry
+		}
+	} else if _, ok := ss.tombstones[sess.Id]; ok {
+		vals := log.MakeValues("peer", peer, "serial", sess.Serial)
+		log.Info(nil, vals, "Ignoring revoked session")
+	} else {
+		ss.lookup[sess.Id] = sess
+	}
 
 	return sess, nil
 }
 
+func (ss *sessionStore) Delete(sess Stamped) (Stamped, error) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	return ss.set(tombstone(sess))
+}
+
+func (ss *sessionStore) DeleteWhere(match func(Session) bool) []Stamped {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	deleted := make([]Stamped, 0)
+	for _, sess := range ss.lookup {
+		if !match(sess.Session) {
+			continue
+		}
+
+		sess.Stamp = Stamp{}
+		sess, err := ss.set(tombstone(sess))
+		if err != nil {
+			log.Error(nil, err, "Unable to delete session")
+			continue
+		}
+		deleted = append(deleted, sess)
+	}
+
+	return deleted
+}
+
+func tombstone(sess Stamped) Stamped {
+	sess.Deleted = true
+	sess.RefreshToken = ""
+	sess.IdToken = ""
+	sess.AccessToken = ""
+
+	retention := time.Now().Add(config.Sessions.TombstoneRetention)
+	if sess.Expiry.Before(retention) {
+		sess.Expiry = retention
+	}
+	return sess
+}
+
+func (ss *sessionStore) Touch(id string, lastSeen time.Time) bool {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	sess, ok := ss.lookup[id]
+	if !ok {
+		return false
+	}
+
+	if lastSeen.After(sess.LastSeen) {
+		sess.LastSeen = lastSeen
+		ss.lookup[id] = sess
+	}
+	return true
+}
+
 func (ss *sessionStore) Stream(from map[string]uint64) <-chan Stamped {
 	ss.mu.RLock()
 	defer ss.mu.RUnlock()
@@ -102,6 +188,11 @@ func (ss *sessionStore) Stream(from map[string]uint64) <-chan Stamped {
 		store[k] = v
 	}
 
+	lastSeen := make(map[string]time.Time, len(ss.lookup))
+	for k, v := range ss.lookup {
+		lastSeen[k] = v.LastSeen
+	}
+
 	ch := make(chan Stamped)
 	go func() {
 		ss.delMu.RLock()
@@ -111,6 +202,9 @@ func (ss *sessionStore) Stream(from map[string]uint64) <-chan Stamped {
 			for e := l.Front(); e != nil; e = e.Next() {
 				v := e.Value.(Stamped)
 				if v.Serial >= from[k] {
+					if t, ok := lastSeen[v.Id]; ok && t.After(v.LastSeen) {
+						v.LastSeen = t
+					}
 					ch <- v
 				}
 			}
@@ -141,13 +235,15 @@ func (ss *sessionStore) clean(min time.Time) {
 	defer ss.delMu.Unlock()
 
 	for _, l := range ss.store {
-		for e := l.Front(); e != nil; e = e.Next() {
+		for e := l.Front(); e != nil; {
+			next := e.Next()
 			v := e.Value.(Stamped)
 			if v.Expiry.Before(min) {
 				ss.mu.RUnlock()
 				ss.delete(l, e)
 				ss.mu.RLock()
 			}
+			e = next
 		}
 	}
 }
@@ -158,5 +254,11 @@ func (ss *sessionStore) delete(l *list.List, e *list.Element) {
 
 	v := e.Value.(Stamped)
 	l.Remove(e)
-	delete(ss.lookup, v.Id)
+	if v.Deleted {
+		if t, ok := ss.tombstones[v.Id]; ok && !t.After(v.Expiry) {
+			delete(ss.tombstones, v.Id)
+		}
+	} else if curr, ok := ss.lookup[v.Id]; ok && curr.Stamp == v.Stamp {
+		delete(ss.lookup, v.Id)
+	}
 }
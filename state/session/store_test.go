@@ -0,0 +1,143 @@
+package session
+
+import (
+	"github.com/KnowitSolutions/istio-oidc/config"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	config.Sessions.TombstoneRetention = time.Hour
+	os.Exit(m.Run())
+}
+
+func TestTombstone(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name    string
+		clean   time.Time
+		replay  Stamped
+		visible bool
+	}{
+		{
+			name:    "replay from peer",
+			replay:  Stamped{Session: Session{Id: "sess", Expiry: now.Add(time.Hour)}, Stamp: Stamp{PeerId: "peer", Serial: 1}},
+			visible: false,
+		},
+		{
+			name:    "replay from self",
+			replay:  Stamped{Session: Session{Id: "sess", Expiry: now.Add(time.Hour)}},
+			visible: false,
+		},
+		{
+			name:    "replay before expiry",
+			clean:   now.Add(30 * time.Minute),
+			replay:  Stamped{Session: Session{Id: "sess", Expiry: now.Add(time.Hour)}, Stamp: Stamp{PeerId: "peer", Serial: 1}},
+			visible: false,
+		},
+		{
+			name:    "new session after expiry",
+			clean:   now.Add(2 * time.Hour),
+			replay:  Stamped{Session: Session{Id: "sess", Expiry: now.Add(3 * time.Hour)}, Stamp: Stamp{PeerId: "peer", Serial: 1}},
+			visible: true,
+		},
+		{
+			name:    "other session",
+			replay:  Stamped{Session: Session{Id: "other", Expiry: now.Add(time.Hour)}, Stamp: Stamp{PeerId: "peer", Serial: 1}},
+			visible: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			store, _ := NewSessionStore("self")
+			ss := store.(*sessionStore)
+
+			sess, err := ss.Set(Stamped{Session: Session{Id: "sess", Expiry: now.Add(time.Minute)}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = ss.Delete(Stamped{Session: sess.Session})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, ok := ss.Get("sess"); ok {
+				t.Fatal("deleted session is still present")
+			}
+
+			if !test.clean.IsZero() {
+				ss.clean(test.clean)
+			}
+
+			_, err = ss.Set(test.replay)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, ok := ss.Get(test.replay.Id); ok != test.visible {
+				t.Errorf("session present = %v, want %v", ok, test.visible)
+			}
+		})
+	}
+}
+
+func TestOutOfOrder(t *testing.T) {
+	tests := []struct {
+		name   string
+		serial uint64
+		err    bool
+	}{
+		{"next", 3, false},
+		{"skipped", 5, false},
+		{"duplicate", 2, true},
+		{"older", 1, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ss, _ := NewSessionStore("self")
+			for _, serial := range []uint64{1, 2} {
+				_, err := ss.Set(Stamped{Session: Session{Id: "sess"}, Stamp: Stamp{PeerId: "peer", Serial: serial}})
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			_, err := ss.Set(Stamped{Session: Session{Id: "sess"}, Stamp: Stamp{PeerId: "peer", Serial: test.serial}})
+			if (err != nil) != test.err {
+				t.Errorf("Set() error = %v, want error %v", err, test.err)
+			}
+		})
+	}
+}
+
+func TestDeleteWhere(t *testing.T) {
+	store, _ := NewSessionStore("self")
+	for _, sess := range []Session{
+		{Id: "a", Subject: "alice"},
+		{Id: "b", Subject: "alice"},
+		{Id: "c", Subject: "bob"},
+	} {
+		_, err := store.Set(Stamped{Session: sess})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	deleted := store.DeleteWhere(func(sess Session) bool { return sess.Subject == "alice" })
+	if len(deleted) != 2 {
+		t.Fatalf("deleted %d sessions, want 2", len(deleted))
+	}
+	for _, sess := range deleted {
+		if !sess.Deleted || sess.PeerId != "self" {
+			t.Errorf("deleted session %q is not a local tombstone", sess.Id)
+		}
+	}
+
+	for id, want := range map[string]bool{"a": false, "b": false, "c": true} {
+		if _, ok := store.Get(id); ok != want {
+			t.Errorf("session %q present = %v, want %v", id, ok, want)
+		}
+	}
+}
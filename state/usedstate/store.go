@@ -0,0 +1,71 @@
+package usedstate
+
+import (
+	"github.com/KnowitSolutions/istio-oidc/config"
+	"github.com/KnowitSolutions/istio-oidc/log"
+	"sync"
+	"time"
+)
+
+type Store interface {
+	Use(string, time.Time) bool
+	Stream() map[string]time.Time
+}
+
+type usedStateStore struct {
+	used map[string]time.Time
+	mu   sync.Mutex
+}
+
+func NewUsedStateStore() Store {
+	s := &usedStateStore{used: map[string]time.Time{}}
+	go s.cleaner()
+	return s
+}
+
+func (s *usedStateStore) Use(id string, expiry time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.used[id]; ok {
+		return false
+	}
+
+	s.used[id] = expiry
+	return true
+}
+
+func (s *usedStateStore) Stream() map[string]time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	used := make(map[string]time.Time, len(s.used))
+	for k, v := range s.used {
+		used[k] = v
+	}
+	return used
+}
+
+func (s *usedStateStore) cleaner() {
+	tick := time.Tick(config.Sessions.CleaningInterval)
+	for {
+		<-tick
+
+		min := time.Now().Add(-config.Sessions.CleaningGracePeriod)
+		vals := log.MakeValues("min", min.Format(time.RFC3339))
+		log.Info(nil, vals, "Cleaning used login states")
+
+		s.clean(min)
+	}
+}
+
+func (s *usedStateStore) clean(min time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for k, v := range s.used {
+		if v.Before(min) {
+			delete(s.used, k)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package usedstate
+
+import (
+	"testing"
+	"time"
+)
+
+func TestUse(t *testing.T) {
+	s := &usedStateStore{used: map[string]time.Time{}}
+	expiry := time.Now().Add(time.Minute)
+
+	tests := []struct {
+		name string
+		id   string
+		want bool
+	}{
+		{"first use", "a", true},
+		{"replay", "a", false},
+		{"other state", "b", true},
+		{"other state replay", "b", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := s.Use(test.id, expiry); got != test.want {
+				t.Errorf("Use(%q) = %v, want %v", test.id, got, test.want)
+			}
+		})
+	}
+}
+
+func TestClean(t *testing.T) {
+	now := time.Now()
+	s := &usedStateStore{used: map[string]time.Time{}}
+	s.Use("expired", now.Add(-time.Minute))
+	s.Use("live", now.Add(time.Minute))
+
+	s.clean(now)
+
+	used := s.Stream()
+	if _, ok := used["expired"]; ok {
+		t.Errorf("expired state was not cleaned")
+	}
+	if _, ok := used["live"]; !ok {
+		t.Errorf("live state was cleaned")
+	}
+	if s.Use("live", now.Add(time.Minute)) {
+		t.Errorf("live state could be reused after cleaning")
+	}
+	if !s.Use("expired", now.Add(time.Minute)) {
+		t.Errorf("cleaned state could not be used")
+	}
+}
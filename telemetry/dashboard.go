@@ -54,6 +54,10 @@ var tmpl = template.Must(template.
 <table>
 	<tr><th>Provider</th><td>{{.Oidc.Provider.Name}}</td></tr>
 	<tr><th>Callback</th><td>{{.Oidc.Callback | fmtUrl}}</td></tr>
+	<tr><th>Logout</th><td>{{.Oidc.Logout | fmtUrl}}</td></tr>
+	<tr><th>Cookie</th><td>{{.Oidc.Cookie.Name}}</td></tr>
+	<tr><th>Scopes</th><td>{{range $i, $v := .Oidc.OAuth2Scopes}}{{if $i}}, {{end}}{{$v}}{{end}}</td></tr>
+	<tr><th>PKCE</th><td>{{if .Oidc.UsePKCE}}yes{{else}}no{{end}}</td></tr>
 	<tr>
 		<th>Virtual hosts</th>
 		<td>{{range $i, $v := .VirtualHosts}}{{if $i}}, {{end}}{{$v}}{{end}}</td>
@@ -66,12 +70,15 @@ var tmpl = template.Must(template.
 	{{range $k, $v := .Routes}}
 	<tr><td>{{$k}}</td>{{template "route" $v}}</tr>
 	{{end}}
+	{{range .Matched}}
+	<tr><td><code>{{.Match}}</code></td>{{template "route" .}}</tr>
+	{{end}}
 </table>
 {{end}}
 
 {{define "route"}}
 <td>{{if .EnableAuthz}}yes{{else}}no{{end}}</td>
-<td>{{range $i, $v := .Roles}}{{if $i}}, {{end}}{{$v}}{{end}}</td>
+<td>{{range $i, $v := .Roles}}{{if $i}}, {{end}}{{$v}}{{end}}{{with .RoleExpression}}<br><code>{{.}}</code>{{end}}</td>
 <td>
 	{{if .Headers}}
 	<table>
@@ -79,8 +86,8 @@ var tmpl = template.Must(template.
 		{{range .Headers}}
 		<tr>
 			<td>{{.Name}}</td>
-			<td>{{.Value}}</td>
-			<td>{{range $i, $v := .Roles}}{{if $i}}, {{end}}{{$v}}{{end}}</td>
+			<td>{{if .Template}}<code>{{.Template.Root}}</code>{{else}}{{.Value}}{{end}}</td>
+			<td>{{range $i, $v := .Roles}}{{if $i}}, {{end}}{{$v}}{{end}}{{with .RoleExpression}}<br><code>{{.}}</code>{{end}}</td>
 		</tr>
 		{{end}}
 	</table>
@@ -90,9 +97,9 @@ var tmpl = template.Must(template.
 
 {{define "sessions"}}
 <table>
-	<tr><th>ID</th><th>Peer</th><th>Expiry</th></tr>
+	<tr><th>ID</th><th>Peer</th><th>Expiry</th><th>Deleted</th></tr>
 	{{range .Sessions}}
-	<tr><td>{{.Id | fmtId}}</td><td>{{.PeerId}}</td><td>{{.Expiry}}</td></tr>
+	<tr><td>{{.Id | fmtId}}</td><td>{{.PeerId}}</td><td>{{.Expiry}}</td><td>{{if .Deleted}}yes{{else}}no{{end}}</td></tr>
 	{{end}}
 </table>
 {{end}}